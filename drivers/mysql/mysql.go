@@ -5,7 +5,9 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"github.com/jumpserver-dev/usql/feature"
 	"github.com/xo/dburl"
 	"io"
 	"net/netip"
@@ -99,8 +101,38 @@ func init() {
 			}
 
 			url.RawQuery = queryParams.Encode()
-			return sql.Open("mysql", url.DSN)
+			if !feature.ReadOnly() {
+				return sql.Open("mysql", url.DSN)
+			}
+			// 只读模式下每个新建的连接都设置为只读会话
+			cfg, err := mysql.ParseDSN(url.DSN)
+			if err != nil {
+				return nil, err
+			}
+			connector, err := mysql.NewConnector(cfg)
+			if err != nil {
+				return nil, err
+			}
+			return sql.OpenDB(readOnlyConnector{connector}), nil
 		}, nil
 	}
 	drivers.Register("mysql", d, "memsql", "vitess", "tidb")
 }
+
+// readOnlyConnector 在建立连接后将会话的事务设置为只读
+type readOnlyConnector struct {
+	driver.Connector
+}
+
+// Connect satisfies the driver.Connector interface.
+func (c readOnlyConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.(driver.ExecerContext).ExecContext(ctx, "SET SESSION TRANSACTION READ ONLY", nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
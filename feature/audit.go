@@ -0,0 +1,99 @@
+package feature
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditLogKey 全局存储中审计日志的键
+const AuditLogKey = "audit-log"
+
+// 命令过滤规则的决定
+const (
+	FilterResultAllowed      = "allowed"
+	FilterResultDenied       = "denied"
+	FilterResultConfirmed    = "confirmed"
+	FilterResultNotConfirmed = "not_confirmed"
+)
+
+// AuditRecord 审计日志中的一条记录，对应一次执行的语句
+type AuditRecord struct {
+	SessionID string `json:"session_id,omitempty"`
+	OSUser    string `json:"os_user"`
+	Driver    string `json:"driver"`
+	DBUser    string `json:"db_user,omitempty"`
+	DBHost    string `json:"db_host,omitempty"`
+	Database  string `json:"database,omitempty"`
+	// Raw 用户输入的语句，Statement 为替换变量后实际执行的语句
+	Raw       string    `json:"raw"`
+	Statement string    `json:"statement"`
+	Start     time.Time `json:"start"`
+	// DurationMS 执行耗时，单位毫秒
+	DurationMS float64 `json:"duration_ms"`
+	// Rows 查询返回的行数或语句影响的行数
+	Rows int64 `json:"rows"`
+	// Truncated 查询结果是否因达到读取限制被截断
+	Truncated bool `json:"truncated,omitempty"`
+	// ErrorCode 驱动 Err 返回的错误码，Error 为脱敏后的错误信息
+	ErrorCode string `json:"error_code,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// ReadOnlyDenied 语句是否因只读模式被拒绝
+	ReadOnlyDenied bool            `json:"read_only_denied,omitempty"`
+	Filter         *FilterDecision `json:"filter,omitempty"`
+	Masking        *MaskingSummary `json:"masking,omitempty"`
+}
+
+// FilterDecision 语句匹配的命令过滤规则及处理结果
+type FilterDecision struct {
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+	// Result 处理结果：allowed、denied、confirmed、not_confirmed
+	Result string `json:"result"`
+}
+
+// AuditLog 以 JSON lines 格式写入审计记录，每条记录一次写入，可以安全地并发使用
+type AuditLog struct {
+	mu      sync.Mutex
+	w       io.Writer
+	session string
+	osUser  string
+}
+
+// NewAuditLog 创建审计日志，session 和 osUser 会写入每一条记录
+func NewAuditLog(w io.Writer, session, osUser string) *AuditLog {
+	return &AuditLog{w: w, session: session, osUser: osUser}
+}
+
+// Write 写入一条审计记录
+func (l *AuditLog) Write(rec AuditRecord) error {
+	rec.SessionID, rec.OSUser = l.session, l.osUser
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(buf, '\n'))
+	return err
+}
+
+// OpenAuditSink 打开审计日志的输出，unix:PATH 连接 unix socket（流式或数据报），
+// 其他值作为文件路径以追加方式打开
+func OpenAuditSink(target string) (io.WriteCloser, error) {
+	if path, ok := strings.CutPrefix(target, "unix:"); ok {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			var gerr error
+			if conn, gerr = net.Dial("unixgram", path); gerr != nil {
+				return nil, err
+			}
+		}
+		return conn, nil
+	}
+	return os.OpenFile(target, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+}
@@ -0,0 +1,163 @@
+package feature
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jumpserver-dev/usql/text"
+)
+
+// MaskingPublicKey 编译时通过 -ldflags 嵌入的 ed25519 公钥，用于验证脱敏规则包的签名，
+// 格式为 base64 编码的 32 字节公钥或 PEM 格式的 PKIX 公钥
+var MaskingPublicKey string
+
+// RuleBundle 带签名的脱敏规则包
+type RuleBundle struct {
+	// Payload base64 编码的 BundlePayload JSON
+	Payload string `json:"payload"`
+	// Signature 对 Payload 解码后内容的 ed25519 签名，base64 编码
+	Signature string `json:"signature"`
+}
+
+// BundlePayload 规则包的内容
+type BundlePayload struct {
+	Rules []DataMaskingRule `json:"rules"`
+	// ExpiresAt 规则包的过期时间，过期后拒绝使用
+	ExpiresAt time.Time `json:"expires_at"`
+	// Session 规则包绑定的会话 ID，只能在该会话中使用
+	Session string `json:"session"`
+}
+
+// LoadOptions 加载脱敏规则的选项
+type LoadOptions struct {
+	// PublicKey 验证签名的公钥
+	PublicKey ed25519.PublicKey
+	// Session 当前会话的 ID
+	Session string
+	// RequireSigned 为 true 时只接受验证通过的规则包
+	RequireSigned bool
+	// Now 当前时间，为零值时使用 time.Now
+	Now time.Time
+	// Lenient 为 true 时规则校验失败也继续加载，错误交给 Warn 处理
+	Lenient bool
+	Warn    func(error)
+}
+
+// IsRuleBundle 判断规则内容是否为规则包，规则包是 JSON 对象，普通规则是 JSON 数组
+func IsRuleBundle(data string) bool {
+	return strings.HasPrefix(strings.TrimSpace(data), "{")
+}
+
+// LoadDataMaskingRules 加载并校验脱敏规则。规则包总是验证签名、有效期和会话绑定；
+// 普通规则只在不要求签名时接受
+func LoadDataMaskingRules(data string, opts LoadOptions) (*RuleSet, error) {
+	var rules []DataMaskingRule
+	var err error
+	switch {
+	case IsRuleBundle(data):
+		rules, err = VerifyRuleBundle(data, opts)
+	case opts.RequireSigned:
+		return nil, text.ErrSignedMaskingRequired
+	default:
+		rules, err = decodeRules([]byte(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateRules(rules); err != nil {
+		if !opts.Lenient {
+			return nil, err
+		}
+		if opts.Warn != nil {
+			opts.Warn(err)
+		}
+		return NewLenientRuleSet(rules), nil
+	}
+	return NewRuleSet(rules)
+}
+
+// VerifyRuleBundle 验证规则包并返回其中的规则
+func VerifyRuleBundle(data string, opts LoadOptions) ([]DataMaskingRule, error) {
+	if len(opts.PublicKey) != ed25519.PublicKeySize {
+		return nil, text.ErrMaskingPublicKeyMissing
+	}
+	var bundle RuleBundle
+	if err := json.Unmarshal([]byte(data), &bundle); err != nil {
+		return nil, fmt.Errorf("%w: %v", text.ErrInvalidMaskingBundle, err)
+	}
+	payload, err := base64.StdEncoding.DecodeString(bundle.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: payload: %v", text.ErrInvalidMaskingBundle, err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(bundle.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", text.ErrInvalidMaskingBundle, err)
+	}
+	// 先验证签名，未通过验证的内容不做任何解析
+	if !ed25519.Verify(opts.PublicKey, payload, sig) {
+		return nil, text.ErrMaskingBundleSignature
+	}
+	var p BundlePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", text.ErrInvalidMaskingBundle, err)
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	switch {
+	case p.ExpiresAt.IsZero(), !now.Before(p.ExpiresAt):
+		return nil, text.ErrMaskingBundleExpired
+	case p.Session == "" || p.Session != opts.Session:
+		return nil, text.ErrMaskingBundleSession
+	}
+	return p.Rules, nil
+}
+
+// LoadPublicKey 返回验证规则包的公钥。编译时嵌入的公钥优先且不能被覆盖，
+// 未嵌入时从 path 读取；都没有时返回 nil
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	switch {
+	case MaskingPublicKey != "" && path != "":
+		return nil, text.ErrMaskingPublicKeyEmbedded
+	case MaskingPublicKey != "":
+		return ParsePublicKey([]byte(MaskingPublicKey))
+	case path != "":
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return ParsePublicKey(buf)
+	}
+	return nil, nil
+}
+
+// ParsePublicKey 解析 base64 编码的 32 字节公钥或 PEM 格式的 PKIX 公钥
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", text.ErrInvalidMaskingPublicKey, err)
+		}
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: not an ed25519 key", text.ErrInvalidMaskingPublicKey)
+		}
+		return key, nil
+	}
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", text.ErrInvalidMaskingPublicKey, err)
+	}
+	if len(buf) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: want %d bytes, got %d", text.ErrInvalidMaskingPublicKey, ed25519.PublicKeySize, len(buf))
+	}
+	return ed25519.PublicKey(buf), nil
+}
@@ -0,0 +1,161 @@
+package feature
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jumpserver-dev/usql/text"
+)
+
+var bundleNow = time.Date(2024, time.May, 17, 10, 0, 0, 0, time.UTC)
+
+// testKey 按种子生成确定的 ed25519 密钥
+func testKey(seed byte) ed25519.PrivateKey {
+	buf := make([]byte, ed25519.SeedSize)
+	for i := range buf {
+		buf[i] = seed
+	}
+	return ed25519.NewKeyFromSeed(buf)
+}
+
+// signBundle 用 key 对 p 签名，返回规则包的 JSON
+func signBundle(t *testing.T, key ed25519.PrivateKey, p BundlePayload) string {
+	t.Helper()
+	payload, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := json.Marshal(RuleBundle{
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+func TestLoadDataMaskingRules(t *testing.T) {
+	key := testKey(1)
+	pub := key.Public().(ed25519.PublicKey)
+	rules := []DataMaskingRule{{Name: "phone", FieldsPattern: "phone", MaskingMethod: MaskingMethodPhone}}
+	valid := BundlePayload{Rules: rules, ExpiresAt: bundleNow.Add(time.Hour), Session: "s1"}
+	// tampered 替换了签名后的内容，签名不变
+	var tampered RuleBundle
+	if err := json.Unmarshal([]byte(signBundle(t, key, valid)), &tampered); err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := json.Marshal(BundlePayload{ExpiresAt: valid.ExpiresAt, Session: "s1"})
+	tampered.Payload = base64.StdEncoding.EncodeToString(payload)
+	tamperedBuf, _ := json.Marshal(tampered)
+	plain, _ := json.Marshal(rules)
+	tests := []struct {
+		name     string
+		data     string
+		key      ed25519.PublicKey
+		required bool
+		err      error
+	}{
+		{"valid bundle", signBundle(t, key, valid), pub, true, nil},
+		{"plain rules", string(plain), nil, false, nil},
+		{"plain rules when signed required", string(plain), pub, true, text.ErrSignedMaskingRequired},
+		{"no rules when signed required", "", pub, true, text.ErrSignedMaskingRequired},
+		{"tampered payload", string(tamperedBuf), pub, true, text.ErrMaskingBundleSignature},
+		{"wrong key", signBundle(t, testKey(2), valid), pub, true, text.ErrMaskingBundleSignature},
+		{"no key", signBundle(t, key, valid), nil, true, text.ErrMaskingPublicKeyMissing},
+		{"expired", signBundle(t, key, BundlePayload{Rules: rules, ExpiresAt: bundleNow, Session: "s1"}), pub, true, text.ErrMaskingBundleExpired},
+		{"no expiry", signBundle(t, key, BundlePayload{Rules: rules, Session: "s1"}), pub, true, text.ErrMaskingBundleExpired},
+		{"other session", signBundle(t, key, BundlePayload{Rules: rules, ExpiresAt: valid.ExpiresAt, Session: "s2"}), pub, true, text.ErrMaskingBundleSession},
+		{"no session", signBundle(t, key, BundlePayload{Rules: rules, ExpiresAt: valid.ExpiresAt}), pub, true, text.ErrMaskingBundleSession},
+		{"malformed bundle", `{"payload": 1}`, pub, true, text.ErrInvalidMaskingBundle},
+		{"malformed signature", `{"payload": "e30=", "signature": "%%"}`, pub, true, text.ErrInvalidMaskingBundle},
+	}
+	for _, test := range tests {
+		rs, err := LoadDataMaskingRules(test.data, LoadOptions{
+			PublicKey:     test.key,
+			Session:       "s1",
+			RequireSigned: test.required,
+			Now:           bundleNow,
+		})
+		switch {
+		case test.err == nil && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case test.err == nil && len(rs.Rules()) != len(rules):
+			t.Errorf("%s: expected %d rules, got %d", test.name, len(rules), len(rs.Rules()))
+		case test.err != nil && !errors.Is(err, test.err):
+			t.Errorf("%s: expected %v, got: %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestLoadPublicKey(t *testing.T) {
+	pub := testKey(1).Public().(ed25519.PublicKey)
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDer, err := x509.MarshalPKIXPublicKey(&ec.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"base64", base64.StdEncoding.EncodeToString(pub) + "\n", nil},
+		{"pem", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil},
+		{"not base64", "not a key", text.ErrInvalidMaskingPublicKey},
+		{"short key", base64.StdEncoding.EncodeToString(pub[:16]), text.ErrInvalidMaskingPublicKey},
+		{"malformed pem", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("garbage")})), text.ErrInvalidMaskingPublicKey},
+		{"not ed25519", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: ecDer})), text.ErrInvalidMaskingPublicKey},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+		if err := os.WriteFile(path, []byte(test.data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		key, err := LoadPublicKey(path)
+		switch {
+		case test.err == nil && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case test.err == nil && !key.Equal(pub):
+			t.Errorf("%s: expected key %x, got %x", test.name, pub, key)
+		case test.err != nil && !errors.Is(err, test.err):
+			t.Errorf("%s: expected %v, got: %v", test.name, test.err, err)
+		}
+	}
+	if _, err := LoadPublicKey(filepath.Join(dir, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: expected %v, got: %v", os.ErrNotExist, err)
+	}
+	if key, err := LoadPublicKey(""); key != nil || err != nil {
+		t.Errorf("no key: expected nil, got %x, %v", key, err)
+	}
+	// 编译时嵌入的公钥不能被覆盖
+	MaskingPublicKey = base64.StdEncoding.EncodeToString(pub)
+	defer func() {
+		MaskingPublicKey = ""
+	}()
+	if _, err := LoadPublicKey(filepath.Join(dir, "base64")); !errors.Is(err, text.ErrMaskingPublicKeyEmbedded) {
+		t.Errorf("embedded key: expected %v, got: %v", text.ErrMaskingPublicKeyEmbedded, err)
+	}
+	if key, err := LoadPublicKey(""); err != nil || !key.Equal(pub) {
+		t.Errorf("embedded key: expected %x, got %x, %v", pub, key, err)
+	}
+}
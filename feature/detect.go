@@ -0,0 +1,180 @@
+package feature
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DataDetectorKey 全局存储中内容识别器的键
+const DataDetectorKey = "data-masking-detector"
+
+// 内置的敏感数据类别
+const (
+	DetectIDCard   = "id_card"
+	DetectBankCard = "bank_card"
+	DetectPhone    = "phone"
+	DetectEmail    = "email"
+)
+
+// detector 一类敏感数据的识别方式，valid 为空时匹配即命中
+type detector struct {
+	name  string
+	re    *regexp.Regexp
+	valid func(string) bool
+	mask  func(string) string
+}
+
+// Detector 按单元格内容识别并遮盖敏感数据，用于弥补按列名匹配的规则遗漏的列，
+// 例如 remark、extra 中的身份证号和手机号。
+// 自定义正则使用 RE2 语法，匹配耗时与输入长度成线性，不会拖慢大批量导出
+type Detector struct {
+	// rate 抽样扫描的行比例，0 到 1
+	rate      float64
+	detectors []detector
+}
+
+// NewDetector 创建内容识别器。rate 为抽样扫描的行比例；
+// patterns 为 NAME=REGEXP 格式的自定义正则，匹配的内容整体遮盖
+func NewDetector(rate float64, patterns []string) (*Detector, error) {
+	if rate <= 0 || rate > 1 {
+		return nil, fmt.Errorf("invalid DLP sample rate %v: must be greater than 0 and at most 1", rate)
+	}
+	var r DataMaskingRule
+	d := &Detector{
+		rate: rate,
+		// 身份证号和手机号先于银行卡号识别，避免被当作银行卡号
+		detectors: []detector{
+			{DetectEmail, regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`), nil, r.maskEmail},
+			{DetectIDCard, regexp.MustCompile(`\b\d{17}[\dXx]\b`), idCardValid, r.maskIDCard},
+			{DetectPhone, regexp.MustCompile(`(?:\+86[- ]?|\b86[- ]?|\b)1[3-9]\d{9}\b`), nil, r.maskPhone},
+			{DetectBankCard, regexp.MustCompile(`\b\d(?:[ -]?\d){11,18}\b`), bankCardValid, r.maskBankCard},
+		},
+	}
+	for _, p := range patterns {
+		name, expr, ok := strings.Cut(p, "=")
+		if !ok || name == "" || expr == "" {
+			return nil, fmt.Errorf("invalid DLP pattern %q: must be NAME=REGEXP", p)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DLP pattern %q: %w", name, err)
+		}
+		d.detectors = append(d.detectors, detector{name: name, re: re, mask: func(s string) string {
+			return r.Params.fullMask(len(graphemes(s)))
+		}})
+	}
+	return d, nil
+}
+
+// bankCardValid 判断去掉分隔符后的数字是否通过 Luhn 校验
+func bankCardValid(s string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(s)
+	return len(digits) >= 12 && len(digits) <= 19 && luhnValid(digits)
+}
+
+// DetectScan 一个结果集的内容识别状态
+type DetectScan struct {
+	d *Detector
+	// acc 抽样的累计量，不小于 1 时扫描当前行
+	acc float64
+	// flagged 已识别出敏感数据的列，之后的每一行都扫描
+	flagged []bool
+	// counts 每一列各类敏感数据的命中次数
+	counts []map[string]int
+}
+
+// NewScan 为有 n 列的结果集创建识别状态
+func (d *Detector) NewScan(n int) *DetectScan {
+	return &DetectScan{
+		d:       d,
+		acc:     1,
+		flagged: make([]bool, n),
+		counts:  make([]map[string]int, n),
+	}
+}
+
+// Row 开始扫描新的一行，返回该行是否被抽样。第一行总是被抽样
+func (s *DetectScan) Row() bool {
+	sampled := s.acc >= 1
+	if sampled {
+		s.acc--
+	}
+	s.acc += s.d.rate
+	return sampled
+}
+
+// Value 识别并遮盖第 i 列的值。未被抽样的行只扫描已识别出敏感数据的列
+func (s *DetectScan) Value(i int, sampled bool, v interface{}) interface{} {
+	if i >= len(s.flagged) || (!sampled && !s.flagged[i]) {
+		return v
+	}
+	var str string
+	switch x := v.(type) {
+	case string:
+		str = x
+	case []byte:
+		str = string(x)
+	case int64:
+		str = strconv.FormatInt(x, 10)
+	case uint64:
+		str = strconv.FormatUint(x, 10)
+	default:
+		return v
+	}
+	masked, hit := s.scan(i, str)
+	if !hit {
+		return v
+	}
+	s.flagged[i] = true
+	return masked
+}
+
+// scan 遮盖字符串中识别出的敏感数据
+func (s *DetectScan) scan(i int, str string) (string, bool) {
+	var hit bool
+	for _, det := range s.d.detectors {
+		str = det.re.ReplaceAllStringFunc(str, func(m string) string {
+			if det.valid != nil && !det.valid(m) {
+				return m
+			}
+			hit = true
+			if s.counts[i] == nil {
+				s.counts[i] = make(map[string]int)
+			}
+			s.counts[i][det.name]++
+			return det.mask(m)
+		})
+	}
+	return str, hit
+}
+
+// Detection 一列中一类敏感数据的命中次数
+type Detection struct {
+	// Set 结果集的序号
+	Set    int    `json:"set"`
+	Column string `json:"column"`
+	Kind   string `json:"kind"`
+	Count  int    `json:"count"`
+}
+
+// Detections 返回第 set 个结果集各列的命中次数，按列和类别排序
+func (s *DetectScan) Detections(set int, cols []string) []Detection {
+	var ds []Detection
+	for i, counts := range s.counts {
+		if i >= len(cols) {
+			break
+		}
+		kinds := make([]string, 0, len(counts))
+		for kind := range counts {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			ds = append(ds, Detection{Set: set, Column: cols[i], Kind: kind, Count: counts[kind]})
+		}
+	}
+	return ds
+}
@@ -0,0 +1,147 @@
+package feature
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChecksums(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid func(string) bool
+		val   string
+		exp   bool
+	}{
+		{"id card", idCardValid, "11010519491231002X", true},
+		{"id card lower x", idCardValid, "11010519491231002x", true},
+		{"id card", idCardValid, "440304199001011233", true},
+		{"id card bad check digit", idCardValid, "110105194912310021", false},
+		{"id card bad check digit", idCardValid, "440304199001011234", false},
+		{"id card short", idCardValid, "11010519491231002", false},
+		{"id card letters", idCardValid, "1101051949123100AX", false},
+		{"bank card", bankCardValid, "6222021234567894", true},
+		{"bank card separators", bankCardValid, "6222 0212 3456 7894", true},
+		{"bank card dashes", bankCardValid, "4111-1111-1111-1111", true},
+		{"bank card", bankCardValid, "6228480012345671", true},
+		{"bank card bad luhn", bankCardValid, "6222021234567890", false},
+		{"bank card bad luhn", bankCardValid, "4111111111111112", false},
+		{"bank card too short", bankCardValid, "42", false},
+		{"bank card too long", bankCardValid, "41111111111111111111", false},
+		{"luhn non digit", luhnValid, "4111a11111111111", false},
+	}
+	for _, test := range tests {
+		if ok := test.valid(test.val); ok != test.exp {
+			t.Errorf("%s: %q: expected %t, got %t", test.name, test.val, test.exp, ok)
+		}
+	}
+}
+
+func TestDetectScanValue(t *testing.T) {
+	d, err := NewDetector(1, []string{`employee_id=EMP-\d{6}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		v   interface{}
+		exp interface{}
+	}{
+		{"id 11010519491231002X", "id 110105***********X"},
+		{[]byte("card 6222 0212 3456 7894"), "card 6222 02** **** 7894"},
+		{"call 13812345678 or +86 13912345678", "call 138****5678 or +86 139****5678"},
+		{int64(13812345678), "138****5678"},
+		{"mail alice@example.com", "mail a***@example.com"},
+		{"EMP-123456", "**********"},
+		// 长度正确但校验位不对的号码不是敏感数据
+		{"id 110105194912310021", "id 110105194912310021"},
+		{"card 6222021234567890", "card 6222021234567890"},
+		{int64(4111111111111112), int64(4111111111111112)},
+		{"order 20240517000123", "order 20240517000123"},
+		{"nothing here", "nothing here"},
+		{3.5, 3.5},
+	}
+	for _, test := range tests {
+		s := d.NewScan(1)
+		if res := s.Value(0, s.Row(), test.v); !reflect.DeepEqual(res, test.exp) {
+			t.Errorf("%v: expected %#v, got %#v", test.v, test.exp, res)
+		}
+	}
+}
+
+func TestDetectScanSampling(t *testing.T) {
+	d, err := NewDetector(0.25, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := d.NewScan(2)
+	var sampled []bool
+	for i := 0; i < 8; i++ {
+		sampled = append(sampled, s.Row())
+	}
+	if exp := []bool{true, false, false, false, true, false, false, false}; !reflect.DeepEqual(sampled, exp) {
+		t.Errorf("expected sampled rows %v, got %v", exp, sampled)
+	}
+
+	// 抽样的行中识别出敏感数据的列，之后未被抽样的行也会扫描
+	s = d.NewScan(2)
+	if res := s.Value(0, s.Row(), "13812345678"); res != "138****5678" {
+		t.Fatalf("expected sampled row to be masked, got %q", res)
+	}
+	for i := 0; i < 3; i++ {
+		sampled := s.Row()
+		if sampled {
+			t.Fatalf("row %d: expected row not to be sampled", i+1)
+		}
+		if res := s.Value(0, sampled, "13912345678"); res != "139****5678" {
+			t.Errorf("row %d: expected flagged column to be rescanned, got %q", i+1, res)
+		}
+		if res := s.Value(1, sampled, "13912345678"); res != "13912345678" {
+			t.Errorf("row %d: expected column not to be scanned, got %q", i+1, res)
+		}
+	}
+}
+
+func TestDetections(t *testing.T) {
+	d, err := NewDetector(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := d.NewScan(3)
+	for _, row := range [][]string{
+		{"13812345678", "plain", "alice@example.com 13812345678"},
+		{"13912345678", "plain", "11010519491231002X"},
+		{"none", "plain", "bob@example.com"},
+	} {
+		sampled := s.Row()
+		for i, v := range row {
+			s.Value(i, sampled, v)
+		}
+	}
+	exp := []Detection{
+		{Set: 1, Column: "phone", Kind: DetectPhone, Count: 2},
+		{Set: 1, Column: "remark", Kind: DetectEmail, Count: 2},
+		{Set: 1, Column: "remark", Kind: DetectIDCard, Count: 1},
+		{Set: 1, Column: "remark", Kind: DetectPhone, Count: 1},
+	}
+	if ds := s.Detections(1, []string{"phone", "name", "remark"}); !reflect.DeepEqual(ds, exp) {
+		t.Errorf("expected %+v, got %+v", exp, ds)
+	}
+}
+
+func TestNewDetector(t *testing.T) {
+	for _, test := range []struct {
+		rate     float64
+		patterns []string
+	}{
+		{0, nil},
+		{-0.5, nil},
+		{1.5, nil},
+		{1, []string{"no-equals"}},
+		{1, []string{"=abc"}},
+		{1, []string{"name="}},
+		{1, []string{"bad=(unclosed"}},
+	} {
+		if _, err := NewDetector(test.rate, test.patterns); err == nil {
+			t.Errorf("rate %v patterns %q: expected error", test.rate, test.patterns)
+		}
+	}
+}
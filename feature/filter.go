@@ -0,0 +1,150 @@
+package feature
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CommandFilterKey DSN 参数和全局存储中命令过滤规则的键
+const CommandFilterKey = "command-filter-rules"
+
+// 命令过滤规则的动作
+const (
+	CommandActionAllow   = "allow"
+	CommandActionDeny    = "deny"
+	CommandActionConfirm = "confirm"
+)
+
+// CommandFilterRule 命令过滤规则，语句满足 Pattern 或 StatementTypes 之一即匹配
+type CommandFilterRule struct {
+	Name string `json:"name"`
+	// Pattern 匹配语句文本的正则（RE2 语法，忽略大小写）
+	Pattern string `json:"pattern,omitempty"`
+	// StatementTypes 匹配的语句类型，例如 DROP、DELETE、ALTER TABLE，按语句开头的关键字匹配，
+	// 不受注释和大小写影响。WITH 语句也按其中各 CTE 和主语句开头的关键字匹配
+	StatementTypes []string `json:"statement_types,omitempty"`
+	// Action 匹配时的动作：allow、deny、confirm
+	Action string `json:"action"`
+
+	re *regexp.Regexp
+}
+
+// CommandFilter 按顺序匹配的命令过滤规则，第一条匹配的规则决定动作，都不匹配时允许执行
+type CommandFilter struct {
+	rules []CommandFilterRule
+}
+
+// ParseCommandFilterRules 解析 JSON 格式的命令过滤规则，规则有误时返回所有错误
+func ParseCommandFilterRules(data string) (*CommandFilter, error) {
+	var rules []CommandFilterRule
+	if err := json.Unmarshal([]byte(data), &rules); err != nil {
+		return nil, fmt.Errorf("invalid command filter rules: %w", err)
+	}
+	return NewCommandFilter(rules)
+}
+
+// NewCommandFilter 校验并编译命令过滤规则
+func NewCommandFilter(rules []CommandFilterRule) (*CommandFilter, error) {
+	var errs []error
+	for i := range rules {
+		r := &rules[i]
+		fail := func(field, format string, v ...interface{}) {
+			errs = append(errs, fmt.Errorf("command filter rule #%d %q: %s: "+format, append([]interface{}{i, r.Name, field}, v...)...))
+		}
+		switch r.Action {
+		case CommandActionAllow, CommandActionDeny, CommandActionConfirm:
+		default:
+			fail("action", "unknown action %q", r.Action)
+		}
+		if r.Pattern == "" && len(r.StatementTypes) == 0 {
+			fail("pattern", "pattern or statement_types is required")
+		}
+		if r.Pattern != "" {
+			if _, err := regexp.Compile(r.Pattern); err != nil {
+				fail("pattern", "%v", err)
+			} else {
+				r.re = regexp.MustCompile("(?is)" + r.Pattern)
+			}
+		}
+		for j, typ := range r.StatementTypes {
+			typ = strings.Join(strings.Fields(strings.ToUpper(typ)), " ")
+			if typ == "" {
+				fail("statement_types", "empty statement type")
+			}
+			r.StatementTypes[j] = typ
+		}
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &CommandFilter{rules: rules}, nil
+}
+
+// Rules 返回命令过滤规则
+func (f *CommandFilter) Rules() []CommandFilterRule {
+	return f.rules
+}
+
+// Check 返回第一条匹配语句的规则，sqlstr 中的每一条语句都会检查，没有规则匹配时返回 nil。
+// 语句类型按驱动的方言切分 token 判断，与只读检查相同，MySQL 的 /*! ... */ 中的内容按语句处理
+func (f *CommandFilter) Check(driver, sqlstr string) *CommandFilterRule {
+	if f == nil {
+		return nil
+	}
+	var prefixes []string
+	for _, toks := range splitStatements(tokenize(sqlstr, DialectFor(driver))) {
+		prefixes = append(prefixes, statementPrefixes(toks)...)
+	}
+	for i := range f.rules {
+		r := &f.rules[i]
+		if r.re != nil && r.re.MatchString(sqlstr) {
+			return r
+		}
+		for _, typ := range r.StatementTypes {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(prefix, typ+" ") {
+					return r
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// statementPrefixes 返回语句开头的关键字，以空格结尾，例如 "ALTER TABLE T "。
+// WITH 语句还返回各 CTE 和主语句开头的关键字，
+// 例如 WITH d AS (DELETE ...) SELECT ... 返回 WITH、DELETE 和 SELECT 开头的三项
+func statementPrefixes(toks []token) []string {
+	for len(toks) != 0 && toks[0].punct("(") {
+		toks = toks[1:]
+	}
+	var b strings.Builder
+	for _, t := range toks {
+		if t.kind != tokWord {
+			break
+		}
+		b.WriteString(strings.ToUpper(t.val) + " ")
+	}
+	prefixes := []string{b.String()}
+	if len(toks) == 0 || !toks[0].is("WITH") {
+		return prefixes
+	}
+	for i := 1; i < len(toks); i++ {
+		if !toks[i].punct("(") {
+			continue
+		}
+		end := matchParen(toks, i)
+		// name [(columns)] AS [NOT] [MATERIALIZED] (...)
+		if toks[i-1].is("AS", "MATERIALIZED") {
+			prefixes = append(prefixes, statementPrefixes(toks[i+1:end])...)
+			if end+1 < len(toks) && !toks[end+1].punct(",") {
+				return append(prefixes, statementPrefixes(toks[end+1:])...)
+			}
+		}
+		i = end
+	}
+	return prefixes
+}
@@ -0,0 +1,42 @@
+package feature
+
+import "testing"
+
+func TestCommandFilterCheck(t *testing.T) {
+	f, err := NewCommandFilter([]CommandFilterRule{
+		{Name: "no-drop", StatementTypes: []string{"drop"}, Action: CommandActionDeny},
+		{Name: "confirm-delete", StatementTypes: []string{"DELETE"}, Action: CommandActionConfirm},
+		{Name: "no-alter-table", StatementTypes: []string{"alter  table"}, Action: CommandActionDeny},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		driver string
+		sqlstr string
+		exp    string
+	}{
+		{"mysql", "DROP TABLE x", "no-drop"},
+		{"mysql", "/* comment */ drop table x", "no-drop"},
+		{"mysql", "/*!DROP TABLE x*/", "no-drop"},
+		{"mysql", "/*!50100 DROP TABLE x */", "no-drop"},
+		{"mysql", "SELECT 1; DROP TABLE x", "no-drop"},
+		{"mysql", "-- DROP TABLE x\nSELECT 1", ""},
+		{"postgres", "/*!DROP TABLE x*/ SELECT 1", ""},
+		{"postgres", "WITH d AS (DELETE FROM t RETURNING *) SELECT * FROM d", "confirm-delete"},
+		{"postgres", "WITH ids(id) AS (SELECT 1) DELETE FROM t WHERE id IN (SELECT id FROM ids)", "confirm-delete"},
+		{"postgres", "WITH a AS (SELECT 1), b AS NOT MATERIALIZED (SELECT 2) SELECT * FROM a, b", ""},
+		{"postgres", "ALTER TABLE t ADD c int", "no-alter-table"},
+		{"postgres", "ALTER INDEX i RENAME TO j", ""},
+		{"postgres", "SELECT 'DROP TABLE x'", ""},
+	}
+	for _, test := range tests {
+		var name string
+		if rule := f.Check(test.driver, test.sqlstr); rule != nil {
+			name = rule.Name
+		}
+		if name != test.exp {
+			t.Errorf("%s: expected rule %q, got %q", test.sqlstr, test.exp, name)
+		}
+	}
+}
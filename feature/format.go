@@ -0,0 +1,129 @@
+package feature
+
+import (
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	emailRE  = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	phoneRE  = regexp.MustCompile(`^(\+?86[- ]?)?(1[3-9]\d{9})$`)
+	idCardRE = regexp.MustCompile(`^\d{17}[\dXx]$`)
+	panRE    = regexp.MustCompile(`^\d[\d -]*\d$`)
+)
+
+// maskEmail 保留本地部分的首字符和完整域名，例如 j***@example.com
+func (r DataMaskingRule) maskEmail(val string) string {
+	if !emailRE.MatchString(val) {
+		return r.Params.fullMask(len(graphemes(val)))
+	}
+	i := strings.LastIndex(val, "@")
+	local := graphemes(val[:i])
+	prefix := min(r.Params.prefix(1), len(local)-1)
+	return strings.Join(local[:prefix], "") + r.Params.fullMask(3) + val[i:]
+}
+
+// maskPhone 保留手机号的前 3 位和后 4 位，例如 138****5678
+func (r DataMaskingRule) maskPhone(val string) string {
+	m := phoneRE.FindStringSubmatch(val)
+	if m == nil {
+		return r.Params.fullMask(len(graphemes(val)))
+	}
+	return m[1] + m[2][:3] + r.Params.fullMask(4) + m[2][7:]
+}
+
+// maskIDCard 18 位居民身份证号只保留前 6 位地区码和最后 1 位校验位
+func (r DataMaskingRule) maskIDCard(val string) string {
+	if !idCardValid(val) {
+		return r.Params.fullMask(len(graphemes(val)))
+	}
+	return val[:6] + r.Params.fullMask(11) + val[17:]
+}
+
+// maskBankCard 银行卡号保留前 6 位和后 4 位数字，分隔符保持不变
+func (r DataMaskingRule) maskBankCard(val string) string {
+	digits := strings.Map(func(c rune) rune {
+		if c == ' ' || c == '-' {
+			return -1
+		}
+		return c
+	}, val)
+	if !panRE.MatchString(val) || len(digits) < 12 || len(digits) > 19 || !luhnValid(digits) {
+		return r.Params.fullMask(len(graphemes(val)))
+	}
+	var b strings.Builder
+	var n int
+	for _, c := range val {
+		if c == ' ' || c == '-' {
+			b.WriteRune(c)
+			continue
+		}
+		if n < 6 || n >= len(digits)-4 {
+			b.WriteRune(c)
+		} else {
+			b.WriteString(r.Params.maskChar())
+		}
+		n++
+	}
+	return b.String()
+}
+
+// maskIP 隐藏 IP 地址的主机位，IPv4 保留前两段，IPv6 保留前四段
+func (r DataMaskingRule) maskIP(val string) string {
+	addr, err := netip.ParseAddr(val)
+	if err != nil {
+		return r.Params.fullMask(len(graphemes(val)))
+	}
+	c := r.Params.maskChar()
+	if addr.Is4() || addr.Is4In6() {
+		b := addr.Unmap().As4()
+		return strings.Join([]string{strconv.Itoa(int(b[0])), strconv.Itoa(int(b[1])), c, c}, ".")
+	}
+	parts := strings.Split(addr.StringExpanded(), ":")
+	for i := 4; i < len(parts); i++ {
+		parts[i] = c
+	}
+	for i := 0; i < 4; i++ {
+		parts[i] = strings.TrimLeft(parts[i], "0")
+		if parts[i] == "" {
+			parts[i] = "0"
+		}
+	}
+	return strings.Join(parts, ":")
+}
+
+// idCardValid 校验 18 位居民身份证号的格式和校验位（GB 11643-1999）
+func idCardValid(val string) bool {
+	if !idCardRE.MatchString(val) {
+		return false
+	}
+	weights := [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	var sum int
+	for i, w := range weights {
+		sum += int(val[i]-'0') * w
+	}
+	return "10X98765432"[sum%11] == strings.ToUpper(val[17:])[0]
+}
+
+// luhnValid 使用 Luhn 算法校验卡号
+func luhnValid(digits string) bool {
+	var sum int
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		c := digits[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,68 @@
+package feature
+
+import (
+	"fmt"
+	"time"
+)
+
+// ResultLimitKey 全局存储中查询结果限制的键
+const ResultLimitKey = "result-limit"
+
+// ResultLimit 单次查询最多读取的行数和字节数，为 0 时不限制
+type ResultLimit struct {
+	MaxRows  int64
+	MaxBytes int64
+}
+
+// ResultLimits 查询结果的读取限制，Conns 为命名连接中配置的限制，按连接名查找
+type ResultLimits struct {
+	Default ResultLimit
+	Conns   map[string]ResultLimit
+}
+
+// For 返回打开连接 name 时生效的限制，命名连接中配置的限制与默认限制取更严格的一个
+func (l *ResultLimits) For(name string) ResultLimit {
+	if c, ok := l.Conns[name]; ok {
+		return l.Default.Stricter(c)
+	}
+	return l.Default
+}
+
+// Empty 判断是否没有任何限制
+func (l ResultLimit) Empty() bool {
+	return l.MaxRows <= 0 && l.MaxBytes <= 0
+}
+
+// Stricter 合并两个限制，每一项取更严格的值
+func (l ResultLimit) Stricter(o ResultLimit) ResultLimit {
+	return ResultLimit{
+		MaxRows:  stricter(l.MaxRows, o.MaxRows),
+		MaxBytes: stricter(l.MaxBytes, o.MaxBytes),
+	}
+}
+
+// stricter 返回两个限制中更严格的一个，0 表示不限制
+func stricter(a, b int64) int64 {
+	switch {
+	case a <= 0:
+		return b
+	case b <= 0 || a < b:
+		return a
+	}
+	return b
+}
+
+// ValueSize 估算值输出时的字节数，用于按字节数限制查询结果
+func ValueSize(v interface{}) int64 {
+	switch x := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(x))
+	case []byte:
+		return int64(len(x))
+	case time.Time:
+		return int64(len(time.RFC3339Nano))
+	}
+	return int64(len(fmt.Sprint(v)))
+}
@@ -1,10 +1,61 @@
 package feature
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dlclark/regexp2"
+	"github.com/rivo/uniseg"
+)
+
 type DataMaskingRule struct {
 	Name          string `json:"name"`
 	FieldsPattern string `json:"fields_pattern"`
-	MaskPattern   string `json:"mask_pattern"`
-	MaskingMethod string `json:"masking_method"`
+	// DatabasePattern、SchemaPattern、TablePattern 限定规则只作用于匹配的库、schema 和表，
+	// 格式与 FieldsPattern 相同，为空时不限制
+	DatabasePattern string        `json:"database_pattern,omitempty"`
+	SchemaPattern   string        `json:"schema_pattern,omitempty"`
+	TablePattern    string        `json:"table_pattern,omitempty"`
+	MaskPattern     string        `json:"mask_pattern"`
+	MaskingMethod   string        `json:"masking_method"`
+	Params          MaskingParams `json:"params"`
+	// HideNull 为 true 时被脱敏列中的 NULL 也显示为遮盖后的值，避免泄露值是否为空
+	HideNull bool `json:"hide_null,omitempty"`
+	// ComputedPolicy 由被脱敏列计算得到的列的处理方式：mask（默认）、block、allow
+	ComputedPolicy string `json:"computed_policy,omitempty"`
+	// UnresolvedPolicy 无法解析语句确定结果列的来源时的处理方式：
+	// mask（默认，所有列都可能取自规则匹配的列，按该规则脱敏）、block（拒绝查询）
+	UnresolvedPolicy string `json:"unresolved_policy,omitempty"`
+	// Priority 多条规则以相同的具体程度匹配同一列时，值大的规则优先，默认 0
+	Priority int `json:"priority,omitempty"`
+
+	// re 是 regex_replace 方法预编译的 MaskPattern
+	re *regexp2.Regexp
+}
+
+// MaskingParams 脱敏方法的参数，未设置的参数使用各方法的默认值
+type MaskingParams struct {
+	// PrefixLength 保留的前缀字符数（按字形簇计算）
+	PrefixLength *int `json:"prefix_length,omitempty"`
+	// SuffixLength 保留的后缀字符数（按字形簇计算）
+	SuffixLength *int `json:"suffix_length,omitempty"`
+	// MaskChar 用于遮盖的字符，默认为 *
+	MaskChar string `json:"mask_char,omitempty"`
+	// MinVisibleLength 值的长度不小于该值时才会保留部分明文，否则整体遮盖
+	MinVisibleLength int `json:"min_visible_length,omitempty"`
+	// Replacement regex_replace 方法的替换模板，支持 $1、${name} 引用分组，
+	// 为空时将匹配到的内容按长度遮盖
+	Replacement string `json:"replacement,omitempty"`
+	// TokenLength hash 方法输出的十六进制字符数，默认 16
+	TokenLength int `json:"token_length,omitempty"`
+	// NumericStrategy 数值列的脱敏策略：zero（默认）、round、bucket
+	NumericStrategy string `json:"numeric_strategy,omitempty"`
+	// NumericStep round 和 bucket 策略使用的步长，默认 100
+	NumericStep float64 `json:"numeric_step,omitempty"`
+	// DatePrecision 日期时间列截断到的精度：year（默认）、month、day
+	DatePrecision string `json:"date_precision,omitempty"`
 }
 
 const DataMaskingKey = "data-masking-rules"
@@ -19,4 +70,226 @@ const (
 	MaskingMethodHideMiddle = "hide_middle"
 	MaskingMethodKeepPrefix = "keep_prefix"
 	MaskingMethodKeepSuffix = "keep_suffix"
+	MaskingMethodEmail      = "email"
+	MaskingMethodPhone      = "phone"
+	MaskingMethodIDCard     = "id_card"
+	MaskingMethodBankCard   = "bank_card"
+	MaskingMethodIP         = "ip"
+	MaskingMethodRegex      = "regex_replace"
+	MaskingMethodHash       = "hash"
+	MaskingMethodTokenize   = "tokenize"
+)
+
+// regexMatchTimeout 限制单次正则替换的耗时，避免回溯过深拖慢查询
+const regexMatchTimeout = time.Second
+
+// 计算列的处理方式
+const (
+	ComputedPolicyMask  = "mask"
+	ComputedPolicyBlock = "block"
+	ComputedPolicyAllow = "allow"
+)
+
+// 无法确定来源的列的处理方式
+const (
+	UnresolvedPolicyMask  = "mask"
+	UnresolvedPolicyBlock = "block"
 )
+
+// 各方法在未配置参数时的默认值
+const (
+	defaultMaskChar     = "*"
+	defaultKeepLength   = 2
+	defaultMiddleLength = 1
+)
+
+// Mask 按规则对值进行脱敏，值按字形簇切分，保证多字节字符不会被截断
+func (r DataMaskingRule) Mask(val string) string {
+	switch r.MaskingMethod {
+	case MaskingMethodFixedChar:
+		// 固定字符替换
+		return r.MaskPattern
+
+	case MaskingMethodHideMiddle:
+		// 隐藏中间
+		return r.keep(val, r.Params.prefix(defaultMiddleLength), r.Params.suffix(defaultMiddleLength))
+
+	case MaskingMethodKeepPrefix:
+		// 保留前缀
+		return r.keep(val, r.Params.prefix(defaultKeepLength), 0)
+
+	case MaskingMethodKeepSuffix:
+		// 保留后缀
+		return r.keep(val, 0, r.Params.suffix(defaultKeepLength))
+
+	case MaskingMethodEmail:
+		// 邮箱，保留首字符和域名
+		return r.maskEmail(val)
+
+	case MaskingMethodPhone:
+		// 手机号，保留前 3 位和后 4 位
+		return r.maskPhone(val)
+
+	case MaskingMethodIDCard:
+		// 身份证号，保留地区码和校验位
+		return r.maskIDCard(val)
+
+	case MaskingMethodBankCard:
+		// 银行卡号，保留前 6 位和后 4 位
+		return r.maskBankCard(val)
+
+	case MaskingMethodIP:
+		// IP 地址，隐藏主机位
+		return r.maskIP(val)
+
+	case MaskingMethodRegex:
+		// 正则替换，仅遮盖匹配到的部分
+		return r.maskRegex(val)
+
+	case MaskingMethodHash:
+		// 带密钥的哈希，同一会话内相同的值得到相同的令牌
+		return r.hash(val)
+
+	case MaskingMethodTokenize:
+		// 保留格式的令牌化，数字仍为数字，长度不变
+		return r.tokenize(val)
+
+	default:
+		// 未知策略，没有 MaskPattern 时整体遮盖
+		if r.MaskPattern == "" {
+			return r.Params.fullMask(len(graphemes(val)))
+		}
+		return r.MaskPattern
+	}
+}
+
+// NullValue 返回被脱敏列中 NULL 的显示值，默认保留 NULL
+func (r DataMaskingRule) NullValue() interface{} {
+	if !r.HideNull {
+		return nil
+	}
+	if r.MaskPattern != "" && r.MaskingMethod == MaskingMethodFixedChar {
+		return r.MaskPattern
+	}
+	return r.Params.fullMask(4)
+}
+
+// Compile 预编译规则中用到的正则表达式
+func (r *DataMaskingRule) Compile() error {
+	if r.MaskingMethod != MaskingMethodRegex {
+		return nil
+	}
+	re, err := compileMaskPattern(r.MaskPattern)
+	if err != nil {
+		return fmt.Errorf("masking rule %q: invalid mask_pattern %q: %w", r.Name, r.MaskPattern, err)
+	}
+	r.re = re
+	return nil
+}
+
+// decodeRules 解析 JSON 格式的脱敏规则
+func decodeRules(data []byte) ([]DataMaskingRule, error) {
+	var rules []DataMaskingRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid data masking rules: %w", err)
+	}
+	return rules, nil
+}
+
+// maskRegex 将 MaskPattern 匹配到的部分按替换模板替换，未匹配的部分保持原样
+func (r DataMaskingRule) maskRegex(val string) string {
+	re := r.re
+	if re == nil {
+		var err error
+		if re, err = compileMaskPattern(r.MaskPattern); err != nil {
+			return r.Params.fullMask(len(graphemes(val)))
+		}
+	}
+	var s string
+	var err error
+	if r.Params.Replacement != "" {
+		s, err = re.Replace(val, r.Params.Replacement, -1, -1)
+	} else {
+		s, err = re.ReplaceFunc(val, func(m regexp2.Match) string {
+			return r.Params.fullMask(len(graphemes(m.String())))
+		}, -1, -1)
+	}
+	if err != nil {
+		// 匹配超时等情况下整体遮盖，避免泄露
+		return r.Params.fullMask(len(graphemes(val)))
+	}
+	return s
+}
+
+// compileMaskPattern 编译 regex_replace 使用的正则
+func compileMaskPattern(pattern string) (*regexp2.Regexp, error) {
+	re, err := regexp2.Compile(pattern, regexp2.None)
+	if err != nil {
+		return nil, err
+	}
+	re.MatchTimeout = regexMatchTimeout
+	return re, nil
+}
+
+// keep 保留前 prefix 个和后 suffix 个字形簇，其余部分遮盖；
+// 值过短时无法保留明文，整体遮盖
+func (r DataMaskingRule) keep(val string, prefix, suffix int) string {
+	clusters := graphemes(val)
+	n := len(clusters)
+	if n == 0 {
+		return val
+	}
+	if n <= prefix+suffix || n < r.Params.MinVisibleLength {
+		return r.Params.fullMask(n)
+	}
+	var b strings.Builder
+	for _, c := range clusters[:prefix] {
+		b.WriteString(c)
+	}
+	b.WriteString(r.Params.fullMask(n - prefix - suffix))
+	for _, c := range clusters[n-suffix:] {
+		b.WriteString(c)
+	}
+	return b.String()
+}
+
+// prefix 返回保留的前缀长度
+func (p MaskingParams) prefix(def int) int {
+	if p.PrefixLength != nil && *p.PrefixLength >= 0 {
+		return *p.PrefixLength
+	}
+	return def
+}
+
+// suffix 返回保留的后缀长度
+func (p MaskingParams) suffix(def int) int {
+	if p.SuffixLength != nil && *p.SuffixLength >= 0 {
+		return *p.SuffixLength
+	}
+	return def
+}
+
+// maskChar 返回遮盖字符
+func (p MaskingParams) maskChar() string {
+	if p.MaskChar != "" {
+		return p.MaskChar
+	}
+	return defaultMaskChar
+}
+
+// fullMask 返回 n 个遮盖字符
+func (p MaskingParams) fullMask(n int) string {
+	return strings.Repeat(p.maskChar(), n)
+}
+
+// graphemes 将字符串切分为字形簇
+func graphemes(s string) []string {
+	clusters := make([]string, 0, len(s))
+	state := -1
+	for s != "" {
+		var c string
+		c, s, _, state = uniseg.FirstGraphemeClusterInString(s, state)
+		clusters = append(clusters, c)
+	}
+	return clusters
+}
@@ -0,0 +1,136 @@
+package feature
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		name string
+		rule DataMaskingRule
+		val  string
+		exp  string
+	}{
+		// fixed_char
+		{"fixed char", DataMaskingRule{MaskingMethod: MaskingMethodFixedChar, MaskPattern: "***"}, "张三", "***"},
+		{"fixed char empty", DataMaskingRule{MaskingMethod: MaskingMethodFixedChar, MaskPattern: "***"}, "", "***"},
+		{"fixed char emoji", DataMaskingRule{MaskingMethod: MaskingMethodFixedChar, MaskPattern: "[hidden]"}, "👨‍👩‍👧", "[hidden]"},
+		// hide_middle
+		{"hide middle", DataMaskingRule{MaskingMethod: MaskingMethodHideMiddle}, "abcdef", "a****f"},
+		{"hide middle cjk", DataMaskingRule{MaskingMethod: MaskingMethodHideMiddle}, "张三丰", "张*丰"},
+		{"hide middle short", DataMaskingRule{MaskingMethod: MaskingMethodHideMiddle}, "张三", "**"},
+		{"hide middle empty", DataMaskingRule{MaskingMethod: MaskingMethodHideMiddle}, "", ""},
+		{"hide middle zwj", DataMaskingRule{MaskingMethod: MaskingMethodHideMiddle}, "👨‍👩‍👧x👍", "👨‍👩‍👧*👍"},
+		{"hide middle skin tone", DataMaskingRule{MaskingMethod: MaskingMethodHideMiddle}, "👍🏽ok👍🏽", "👍🏽**👍🏽"},
+		{"hide middle flags", DataMaskingRule{MaskingMethod: MaskingMethodHideMiddle}, "🇨🇳🇺🇸🇯🇵", "🇨🇳*🇯🇵"},
+		{"hide middle combining", DataMaskingRule{MaskingMethod: MaskingMethodHideMiddle}, "e\u0301cole\u0301", "e\u0301***e\u0301"},
+		{"hide middle mask char", DataMaskingRule{MaskingMethod: MaskingMethodHideMiddle, Params: MaskingParams{MaskChar: "●"}}, "张三丰", "张●丰"},
+		{"hide middle prefix and suffix", DataMaskingRule{MaskingMethod: MaskingMethodHideMiddle, Params: MaskingParams{PrefixLength: intPtr(3), SuffixLength: intPtr(4)}}, "13812345678", "138****5678"},
+		{"hide middle prefix and suffix cover value", DataMaskingRule{MaskingMethod: MaskingMethodHideMiddle, Params: MaskingParams{PrefixLength: intPtr(2), SuffixLength: intPtr(2)}}, "abcd", "****"},
+		{"hide middle zero prefix and suffix", DataMaskingRule{MaskingMethod: MaskingMethodHideMiddle, Params: MaskingParams{PrefixLength: intPtr(0), SuffixLength: intPtr(0)}}, "abc", "***"},
+		// keep_prefix
+		{"keep prefix", DataMaskingRule{MaskingMethod: MaskingMethodKeepPrefix}, "abcdef", "ab****"},
+		{"keep prefix cjk", DataMaskingRule{MaskingMethod: MaskingMethodKeepPrefix}, "北京市朝阳区", "北京****"},
+		{"keep prefix combining", DataMaskingRule{MaskingMethod: MaskingMethodKeepPrefix}, "e\u0301cole", "e\u0301c***"},
+		{"keep prefix zwj", DataMaskingRule{MaskingMethod: MaskingMethodKeepPrefix, Params: MaskingParams{PrefixLength: intPtr(1)}}, "👩‍💻dev", "👩‍💻***"},
+		{"keep prefix short", DataMaskingRule{MaskingMethod: MaskingMethodKeepPrefix}, "ab", "**"},
+		{"keep prefix zero", DataMaskingRule{MaskingMethod: MaskingMethodKeepPrefix, Params: MaskingParams{PrefixLength: intPtr(0)}}, "abc", "***"},
+		{"keep prefix longer than value", DataMaskingRule{MaskingMethod: MaskingMethodKeepPrefix, Params: MaskingParams{PrefixLength: intPtr(5)}}, "abc", "***"},
+		{"keep prefix negative uses default", DataMaskingRule{MaskingMethod: MaskingMethodKeepPrefix, Params: MaskingParams{PrefixLength: intPtr(-1)}}, "abcd", "ab**"},
+		{"keep prefix below min visible", DataMaskingRule{MaskingMethod: MaskingMethodKeepPrefix, Params: MaskingParams{MinVisibleLength: 6}}, "abcde", "*****"},
+		{"keep prefix at min visible", DataMaskingRule{MaskingMethod: MaskingMethodKeepPrefix, Params: MaskingParams{MinVisibleLength: 6}}, "abcdef", "ab****"},
+		{"keep prefix min visible counts clusters", DataMaskingRule{MaskingMethod: MaskingMethodKeepPrefix, Params: MaskingParams{MinVisibleLength: 4}}, "张三丰", "***"},
+		// keep_suffix
+		{"keep suffix", DataMaskingRule{MaskingMethod: MaskingMethodKeepSuffix}, "13812345678", "*********78"},
+		{"keep suffix cjk", DataMaskingRule{MaskingMethod: MaskingMethodKeepSuffix}, "中华人民共和国", "*****和国"},
+		{"keep suffix flags", DataMaskingRule{MaskingMethod: MaskingMethodKeepSuffix}, "🇨🇳🇺🇸🇯🇵", "*🇺🇸🇯🇵"},
+		{"keep suffix combining", DataMaskingRule{MaskingMethod: MaskingMethodKeepSuffix, Params: MaskingParams{SuffixLength: intPtr(3)}}, "nai\u0308ve", "**i\u0308ve"},
+		{"keep suffix short", DataMaskingRule{MaskingMethod: MaskingMethodKeepSuffix}, "张三", "**"},
+		{"keep suffix zero", DataMaskingRule{MaskingMethod: MaskingMethodKeepSuffix, Params: MaskingParams{SuffixLength: intPtr(0)}}, "abc", "***"},
+		{"keep suffix below min visible", DataMaskingRule{MaskingMethod: MaskingMethodKeepSuffix, Params: MaskingParams{MinVisibleLength: 8, MaskChar: "#"}}, "1234567", "#######"},
+		// email
+		{"email", DataMaskingRule{MaskingMethod: MaskingMethodEmail}, "alice@example.com", "a***@example.com"},
+		{"email cjk", DataMaskingRule{MaskingMethod: MaskingMethodEmail}, "张三@例子.中国", "张***@例子.中国"},
+		{"email single character local part", DataMaskingRule{MaskingMethod: MaskingMethodEmail}, "a@example.com", "***@example.com"},
+		{"email prefix length", DataMaskingRule{MaskingMethod: MaskingMethodEmail, Params: MaskingParams{PrefixLength: intPtr(3)}}, "alice@x.com", "ali***@x.com"},
+		{"email without at", DataMaskingRule{MaskingMethod: MaskingMethodEmail}, "alice.example.com", strings.Repeat("*", 17)},
+		{"email without domain dot", DataMaskingRule{MaskingMethod: MaskingMethodEmail}, "alice@localhost", strings.Repeat("*", 15)},
+		{"email two ats", DataMaskingRule{MaskingMethod: MaskingMethodEmail}, "a@b@c.com", strings.Repeat("*", 9)},
+		// phone
+		{"phone", DataMaskingRule{MaskingMethod: MaskingMethodPhone}, "13812345678", "138****5678"},
+		{"phone country code", DataMaskingRule{MaskingMethod: MaskingMethodPhone}, "+86 13812345678", "+86 138****5678"},
+		{"phone country code without separator", DataMaskingRule{MaskingMethod: MaskingMethodPhone}, "8613812345678", "86138****5678"},
+		{"phone short", DataMaskingRule{MaskingMethod: MaskingMethodPhone}, "1381234567", strings.Repeat("*", 10)},
+		{"phone invalid prefix", DataMaskingRule{MaskingMethod: MaskingMethodPhone}, "12812345678", strings.Repeat("*", 11)},
+		{"phone separators", DataMaskingRule{MaskingMethod: MaskingMethodPhone}, "138-1234-5678", strings.Repeat("*", 13)},
+		{"phone fullwidth digits", DataMaskingRule{MaskingMethod: MaskingMethodPhone}, "１３８１２３４５６７８", strings.Repeat("*", 11)},
+		// id_card
+		{"id card", DataMaskingRule{MaskingMethod: MaskingMethodIDCard}, "11010519491231002X", "110105***********X"},
+		{"id card bad check digit", DataMaskingRule{MaskingMethod: MaskingMethodIDCard}, "110105194912310021", strings.Repeat("*", 18)},
+		{"id card 15 digits", DataMaskingRule{MaskingMethod: MaskingMethodIDCard}, "110105491231002", strings.Repeat("*", 15)},
+		{"id card arabic-indic digits", DataMaskingRule{MaskingMethod: MaskingMethodIDCard}, "١١٠١٠٥١٩٤٩١٢٣١٠٠٢X", strings.Repeat("*", 18)},
+		// bank_card
+		{"bank card", DataMaskingRule{MaskingMethod: MaskingMethodBankCard}, "6222021234567894", "622202******7894"},
+		{"bank card separators", DataMaskingRule{MaskingMethod: MaskingMethodBankCard}, "6222 0212 3456 7894", "6222 02** **** 7894"},
+		{"bank card bad luhn", DataMaskingRule{MaskingMethod: MaskingMethodBankCard}, "6222021234567890", strings.Repeat("*", 16)},
+		{"bank card short", DataMaskingRule{MaskingMethod: MaskingMethodBankCard}, "12345", strings.Repeat("*", 5)},
+		{"bank card fullwidth digits", DataMaskingRule{MaskingMethod: MaskingMethodBankCard}, "６２２２０２１２３４５６７８９４", strings.Repeat("*", 16)},
+		// ip
+		{"ipv4", DataMaskingRule{MaskingMethod: MaskingMethodIP}, "192.168.1.23", "192.168.*.*"},
+		{"ipv4 mapped", DataMaskingRule{MaskingMethod: MaskingMethodIP}, "::ffff:10.1.2.3", "10.1.*.*"},
+		{"ipv6", DataMaskingRule{MaskingMethod: MaskingMethodIP}, "2001:db8:85a3::8a2e:370:7334", "2001:db8:85a3:0:*:*:*:*"},
+		{"ipv6 zone", DataMaskingRule{MaskingMethod: MaskingMethodIP}, "fe80::1%eth0", "fe80:0:0:0:*:*:*:*"},
+		{"ipv4 out of range", DataMaskingRule{MaskingMethod: MaskingMethodIP}, "256.1.1.1", strings.Repeat("*", 9)},
+		{"ipv4 short", DataMaskingRule{MaskingMethod: MaskingMethodIP}, "10.1.2", strings.Repeat("*", 6)},
+		{"ip host name", DataMaskingRule{MaskingMethod: MaskingMethodIP}, "localhost", strings.Repeat("*", 9)},
+		{"ip fullwidth digits", DataMaskingRule{MaskingMethod: MaskingMethodIP}, "１９２.１６８.１.１", strings.Repeat("*", 11)},
+		// regex_replace
+		{"regex replace groups", DataMaskingRule{MaskingMethod: MaskingMethodRegex, MaskPattern: `(\d{3})\d{4}(\d{4})`, Params: MaskingParams{Replacement: "$1****$2"}}, "tel 13812345678", "tel 138****5678"},
+		{"regex replace named groups", DataMaskingRule{MaskingMethod: MaskingMethodRegex, MaskPattern: `(?<user>[^@]+)@(?<domain>.+)`, Params: MaskingParams{Replacement: "***@${domain}"}}, "alice@example.com", "***@example.com"},
+		{"regex replace literal dollar", DataMaskingRule{MaskingMethod: MaskingMethodRegex, MaskPattern: `\d+`, Params: MaskingParams{Replacement: "$$"}}, "cost 100", "cost $"},
+		{"regex replace by length", DataMaskingRule{MaskingMethod: MaskingMethodRegex, MaskPattern: `\d+`}, "order 12345 for 张三", "order ***** for 张三"},
+		{"regex replace by length counts clusters", DataMaskingRule{MaskingMethod: MaskingMethodRegex, MaskPattern: `\p{Han}+`}, "name: 张三丰", "name: ***"},
+		{"regex replace by length mask char", DataMaskingRule{MaskingMethod: MaskingMethodRegex, MaskPattern: `\d`, Params: MaskingParams{MaskChar: "#"}}, "a1b22", "a#b##"},
+		{"regex replace no match", DataMaskingRule{MaskingMethod: MaskingMethodRegex, MaskPattern: `\d+`}, "abc", "abc"},
+		{"regex replace invalid pattern", DataMaskingRule{MaskingMethod: MaskingMethodRegex, MaskPattern: `(abc`}, "abc张三", "*****"},
+	}
+	for _, test := range tests {
+		if res := test.rule.Mask(test.val); res != test.exp {
+			t.Errorf("%s: %q: expected %q, got %q", test.name, test.val, test.exp, res)
+		}
+	}
+}
+
+func TestMaskRegexCompile(t *testing.T) {
+	r := DataMaskingRule{Name: "bad", MaskingMethod: MaskingMethodRegex, MaskPattern: `(abc`}
+	if err := r.Compile(); err == nil {
+		t.Fatalf("expected error compiling %q", r.MaskPattern)
+	}
+	r = DataMaskingRule{Name: "digits", MaskingMethod: MaskingMethodRegex, MaskPattern: `\d+`}
+	if err := r.Compile(); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if r.re == nil || r.re.MatchTimeout != regexMatchTimeout {
+		t.Fatalf("expected compiled pattern with match timeout %v", regexMatchTimeout)
+	}
+	if res, exp := r.Mask("id 42"), "id **"; res != exp {
+		t.Errorf("expected %q, got %q", exp, res)
+	}
+}
+
+func TestMaskRegexTimeout(t *testing.T) {
+	val := strings.Repeat("a", 30) + "!"
+	for _, replacement := range []string{"", "x"} {
+		r := DataMaskingRule{MaskingMethod: MaskingMethodRegex, MaskPattern: `(a+)+$`, Params: MaskingParams{Replacement: replacement}}
+		if err := r.Compile(); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		// 灾难性回溯的正则在超时后整体遮盖
+		r.re.MatchTimeout = 10 * time.Millisecond
+		if res, exp := r.Mask(val), strings.Repeat("*", len(val)); res != exp {
+			t.Errorf("replacement %q: expected %q, got %q", replacement, exp, res)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package feature
+
+import (
+	"strings"
+
+	"github.com/jumpserver-dev/usql/store"
+)
+
+// ReadOnlyKey 全局存储中只读模式的键
+const ReadOnlyKey = "read-only"
+
+// ReadOnly 返回是否启用了只读模式
+func ReadOnly() bool {
+	v, ok := store.GetGlobalStore().Get(ReadOnlyKey)
+	return ok && v == true
+}
+
+// writeWords 出现在语句中（不作为函数名）即视为写操作的关键字，
+// 用于发现 WITH 中的数据修改语句、EXPLAIN ANALYZE 等会实际执行的写操作
+var writeWords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "UPSERT": true,
+	"TRUNCATE": true, "DROP": true, "CREATE": true, "ALTER": true, "RENAME": true,
+	"GRANT": true, "REVOKE": true,
+}
+
+// CheckReadOnly 检查语句（可能包含多条）是否都是只读的，不是时返回第一条写语句的类型，
+// 例如 INSERT。无法识别的语句一律视为写语句，只有注释的语句也不例外
+func CheckReadOnly(driver, sqlstr string) (string, bool) {
+	toks := tokenize(sqlstr, DialectFor(driver))
+	if len(toks) == 0 && strings.TrimSpace(sqlstr) != "" {
+		return statementType(toks), false
+	}
+	for _, toks := range splitStatements(toks) {
+		if !readOnlyStatement(driver, toks) {
+			return statementType(toks), false
+		}
+	}
+	return "", true
+}
+
+// readOnlyStatement 判断单条语句是否只读
+func readOnlyStatement(driver string, toks []token) bool {
+	// 带括号的查询，例如 (SELECT ...) UNION (SELECT ...)
+	for len(toks) != 0 && toks[0].punct("(") {
+		toks = toks[1:]
+	}
+	if len(toks) == 0 || toks[0].kind != tokWord {
+		return false
+	}
+	first := strings.ToUpper(toks[0].val)
+	switch first {
+	case "SHOW", "DESCRIBE", "DESC":
+		// SHOW CREATE TABLE 等，不需要检查写操作的关键字
+		return true
+	}
+	if hasWrite(toks) || setConfig(toks) {
+		return false
+	}
+	switch first {
+	case "SELECT", "WITH", "VALUES", "TABLE":
+		// SELECT ... INTO 会创建表或写文件，FOR UPDATE 等会加锁
+		return !hasWord(toks, "INTO") && !lockingRead(toks)
+	case "EXPLAIN":
+		// Oracle 的 EXPLAIN PLAN 会写入 PLAN_TABLE
+		return driver != "oracle"
+	case "EXISTS":
+		return driver == "clickhouse"
+	case "USE":
+		return driver != "postgres" && driver != "oracle"
+	case "FETCH", "MOVE", "CLOSE", "DECLARE":
+		// 游标，DECLARE 中的查询已经检查过写操作
+		return driver == "postgres" && !lockingRead(toks)
+	case "SET", "RESET":
+		return safeSet(toks)
+	case "BEGIN":
+		switch driver {
+		case "oracle":
+			// PL/SQL 块
+			return false
+		case "sqlserver":
+			// BEGIN ... END 是语句块，只允许 BEGIN TRAN
+			return len(toks) > 1 && toks[1].is("TRAN", "TRANSACTION") && !readWrite(toks)
+		}
+		return !readWrite(toks)
+	case "START":
+		return len(toks) > 1 && toks[1].is("TRANSACTION") && !readWrite(toks)
+	case "COMMIT", "ROLLBACK", "END", "SAVEPOINT", "RELEASE", "ABORT":
+		return true
+	}
+	return false
+}
+
+// safeSet 判断 SET 语句是否不会关闭只读限制或修改全局配置，
+// 例如 SET SESSION TRANSACTION READ WRITE、SET @@transaction_read_only = 0、SET GLOBAL ...
+func safeSet(toks []token) bool {
+	if readWrite(toks) {
+		return false
+	}
+	for _, t := range toks {
+		if t.kind != tokWord && t.kind != tokIdent {
+			continue
+		}
+		name := strings.ToUpper(t.val)
+		switch {
+		case strings.Contains(name, "READ_ONLY"), strings.Contains(name, "READONLY"),
+			name == "GLOBAL", name == "PERSIST", name == "PERSIST_ONLY",
+			strings.HasPrefix(name, "@@GLOBAL."), strings.HasPrefix(name, "@@PERSIST"):
+			return false
+		}
+	}
+	return true
+}
+
+// hasWrite 判断语句中是否出现写操作的关键字，后面紧跟括号的视为函数调用，例如 REPLACE(...)
+func hasWrite(toks []token) bool {
+	for i, t := range toks {
+		if t.kind == tokWord && writeWords[strings.ToUpper(t.val)] && (i+1 == len(toks) || !toks[i+1].punct("(")) {
+			return true
+		}
+	}
+	return false
+}
+
+// setConfig 判断语句是否调用 set_config 修改只读相关的设置，例如
+// SELECT set_config('default_transaction_read_only', 'off', false)。
+// 设置名不是字符串常量时无法判断，同样视为修改
+func setConfig(toks []token) bool {
+	for i := 0; i+1 < len(toks); i++ {
+		t := toks[i]
+		if t.kind != tokWord && t.kind != tokIdent || !strings.EqualFold(t.val, "set_config") || !toks[i+1].punct("(") {
+			continue
+		}
+		if i+2 == len(toks) || toks[i+2].kind != tokString {
+			return true
+		}
+		if name := strings.ToUpper(toks[i+2].val); strings.Contains(name, "READ_ONLY") || strings.Contains(name, "READONLY") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWord 判断语句中是否出现关键字
+func hasWord(toks []token, word string) bool {
+	for _, t := range toks {
+		if t.is(word) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockingRead 判断是否为加锁读，例如 FOR UPDATE、FOR SHARE、LOCK IN SHARE MODE
+func lockingRead(toks []token) bool {
+	for i := 0; i+1 < len(toks); i++ {
+		switch {
+		case toks[i].is("FOR") && toks[i+1].is("UPDATE", "SHARE", "NO", "KEY"),
+			toks[i].is("LOCK") && toks[i+1].is("IN"):
+			return true
+		}
+	}
+	return false
+}
+
+// readWrite 判断语句中是否出现 READ WRITE
+func readWrite(toks []token) bool {
+	for i := 0; i+1 < len(toks); i++ {
+		if toks[i].is("READ") && toks[i+1].is("WRITE") {
+			return true
+		}
+	}
+	return false
+}
+
+// statementType 返回语句开头的关键字，用于错误信息
+func statementType(toks []token) string {
+	for _, t := range toks {
+		if t.kind == tokWord {
+			return strings.ToUpper(t.val)
+		}
+	}
+	return "statement"
+}
@@ -0,0 +1,34 @@
+package feature
+
+import "testing"
+
+func TestCheckReadOnly(t *testing.T) {
+	tests := []struct {
+		driver string
+		sqlstr string
+		exp    bool
+	}{
+		{"mysql", "SELECT * FROM t", true},
+		{"mysql", "SELECT 1 /* DELETE FROM t */", true},
+		{"mysql", "SHOW CREATE TABLE t", true},
+		{"mysql", "/*!DELETE FROM t*/", false},
+		{"mysql", "/*!50100 DELETE FROM t */", false},
+		{"mysql", "SELECT * FROM t /*!INTO OUTFILE '/tmp/x'*/", false},
+		{"mysql", "SELECT 1; DELETE FROM t", false},
+		{"mysql", "/* only a comment */", false},
+		{"mysql", "-- only a comment", false},
+		{"postgres", "/*!DELETE FROM t*/ SELECT 1", true},
+		{"postgres", "WITH d AS (DELETE FROM t RETURNING *) SELECT * FROM d", false},
+		{"postgres", "SELECT set_config('default_transaction_read_only', 'off', false)", false},
+		{"postgres", "SELECT pg_catalog.set_config('transaction_read_only', 'off', true)", false},
+		{"postgres", "SELECT set_config(E'default_transaction_read_only', 'off', false)", false},
+		{"postgres", "SELECT set_config('application_name', 'x', false)", true},
+		{"postgres", "SET default_transaction_read_only = off", false},
+		{"postgres", "SELECT * FROM t FOR UPDATE", false},
+	}
+	for _, test := range tests {
+		if _, ok := CheckReadOnly(test.driver, test.sqlstr); ok != test.exp {
+			t.Errorf("%s: %s: expected read-only %t, got %t", test.driver, test.sqlstr, test.exp, ok)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package feature
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Recorder 以 asciicast v2 格式录制会话，每个事件立即写入，进程异常退出时已写入的部分仍然可以回放
+type Recorder struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	// pending 上一次输出末尾不完整的 UTF-8 字符，与下一次输出合并后再写入
+	pending []byte
+	// err 第一次写入失败的错误，之后不再写入
+	err error
+}
+
+// recordHeader asciicast v2 的文件头
+type recordHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// NewRecorder 写入文件头并开始录制，width 和 height 为终端的列数和行数
+func NewRecorder(w io.Writer, width, height int) (*Recorder, error) {
+	r := &Recorder{w: w, start: time.Now()}
+	env := make(map[string]string)
+	for _, k := range []string{"SHELL", "TERM"} {
+		if v := os.Getenv(k); v != "" {
+			env[k] = v
+		}
+	}
+	if err := r.write(recordHeader{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.start.Unix(),
+		Env:       env,
+	}); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Output 录制终端输出，换行转换为终端实际输出的 \r\n
+func (r *Recorder) Output(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	buf := append(r.pending, p...)
+	// 保留末尾不完整的字符，避免 JSON 编码时被替换为 U+FFFD
+	i := len(buf)
+	for j := len(buf) - 1; j >= 0 && j >= len(buf)-utf8.UTFMax; j-- {
+		if utf8.RuneStart(buf[j]) {
+			if !utf8.FullRune(buf[j:]) {
+				i = j
+			}
+			break
+		}
+	}
+	r.pending = append([]byte(nil), buf[i:]...)
+	if i == 0 {
+		return
+	}
+	s := strings.ReplaceAll(strings.ReplaceAll(string(buf[:i]), "\r\n", "\n"), "\n", "\r\n")
+	r.event("o", s)
+}
+
+// Input 录制用户输入
+func (r *Recorder) Input(s string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event("i", s)
+}
+
+// Err 返回写入录像时的错误
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// event 写入一个事件，格式为 [秒数, 类型, 数据]
+func (r *Recorder) event(typ, data string) {
+	if r.err != nil {
+		return
+	}
+	r.err = r.write([]interface{}{time.Since(r.start).Seconds(), typ, data})
+}
+
+// write 将 v 编码为一行 JSON 写入
+func (r *Recorder) write(v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = r.w.Write(append(buf, '\n'))
+	return err
+}
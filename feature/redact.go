@@ -0,0 +1,147 @@
+package feature
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jumpserver-dev/usql/store"
+)
+
+// redactedValue 无法确定所属列时，错误信息中的值统一替换为该字符串，不泄露长度
+const redactedValue = "***"
+
+// errorValuePattern 错误信息中包含数据的格式
+type errorValuePattern struct {
+	re *regexp.Regexp
+	// value 值所在的分组
+	value int
+	// column 列名所在的分组，为 0 时列名未知
+	column int
+	// index 为 true 时 column 分组是索引名，索引名可能与列名相同，但不能确定
+	index bool
+	// list 为 true 时列名和值都是逗号分隔的列表
+	list bool
+}
+
+// errorValuePatterns 各数据库错误信息中包含数据的格式
+var errorValuePatterns = []errorValuePattern{
+	// MySQL 1062: Duplicate entry '13800000000' for key 'users.phone'
+	{re: regexp.MustCompile(`(Duplicate entry ')((?:[^']|'')*)(' for key ')([^']*)(')`), value: 2, column: 4, index: true},
+	// MySQL 1366: Incorrect integer value: 'abc' for column 'age' at row 1
+	{re: regexp.MustCompile(`(Incorrect [\w ]+ value: ')((?:[^']|'')*)(' for column ')([^']*)(')`), value: 2, column: 4},
+	// PostgreSQL: Key (id_card)=(110101199003077777) already exists.
+	{re: regexp.MustCompile(`(Key \()([^)]*)(\)=\()(.*)(\))`), value: 4, column: 2, list: true},
+	// PostgreSQL: Failing row contains (1, 13800000000, null).
+	{re: regexp.MustCompile(`(Failing row contains \()(.*)(\))`), value: 2},
+	// PostgreSQL: invalid input syntax for type integer: "abc"
+	{re: regexp.MustCompile(`(invalid input (?:syntax|value) for [^:]*: ")((?:[^"]|"")*)(")`), value: 2},
+	// SQL Server 2627: The duplicate key value is (13800000000).
+	{re: regexp.MustCompile(`(The duplicate key value is \()(.*)(\))`), value: 2},
+}
+
+// RedactMessage 按当前会话的脱敏规则处理错误信息中的值，没有脱敏规则时原样返回
+func RedactMessage(msg string) string {
+	v, ok := store.GetGlobalStore().Get(DataMaskingKey)
+	if !ok {
+		return msg
+	}
+	rs, ok := v.(*RuleSet)
+	if !ok {
+		return msg
+	}
+	return rs.Redact(msg)
+}
+
+// RedactError 返回错误信息经过 RedactMessage 处理的错误，
+// 信息没有变化时返回原错误，errors.Is 和 errors.As 仍可用于原错误。
+// 错误只在显示和写入审计日志前处理一次，驱动的 Err 不做处理，避免已脱敏的值被再次脱敏
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if s := RedactMessage(msg); s != msg {
+		return &redactedError{msg: s, err: err}
+	}
+	return err
+}
+
+// redactedError 错误信息经过脱敏的错误
+type redactedError struct {
+	msg string
+	err error
+}
+
+// Error satisfies the error interface.
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the original error.
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// Redact 处理错误信息中的值：列名已知时按匹配该列的规则脱敏，没有规则匹配时保留，
+// 与查询结果的显示一致；列名未知时统一替换为 ***
+func (rs *RuleSet) Redact(msg string) string {
+	for _, p := range errorValuePatterns {
+		msg = p.re.ReplaceAllStringFunc(msg, func(m string) string {
+			groups := p.re.FindStringSubmatch(m)
+			groups[p.value] = rs.redactValues(p, groups)
+			return strings.Join(groups[1:], "")
+		})
+	}
+	return msg
+}
+
+// redactValues 处理一个匹配中的值
+func (rs *RuleSet) redactValues(p errorValuePattern, groups []string) string {
+	value := groups[p.value]
+	if p.column == 0 {
+		return redactedValue
+	}
+	if !p.list {
+		return rs.redactValue(groups[p.column], value, p.index)
+	}
+	cols, vals := strings.Split(groups[p.column], ","), strings.Split(value, ",")
+	if len(cols) != len(vals) {
+		// 值中含有逗号，无法与列对应
+		return redactedValue
+	}
+	for i := range vals {
+		v := strings.TrimSpace(vals[i])
+		vals[i] = strings.Replace(vals[i], v, rs.redactValue(strings.TrimSpace(cols[i]), v, false), 1)
+	}
+	return strings.Join(vals, ",")
+}
+
+// redactValue 按匹配列 col 的规则处理值。col 是索引名时，
+// 没有规则匹配也不能确定不是敏感列，替换为 ***
+func (rs *RuleSet) redactValue(col, value string, index bool) string {
+	// 去掉表名等限定
+	if i := strings.LastIndex(col, "."); i != -1 {
+		col = col[i+1:]
+	}
+	col = strings.Trim(col, "`\"")
+	var cands []candidate
+	for i := range rs.rules {
+		if cand, ok := rs.rules[i].matchColumn(Dialect{}, col, ColumnSource{}); ok {
+			cands = append(cands, cand)
+		}
+	}
+	if len(cands) == 0 {
+		if index {
+			return redactedValue
+		}
+		return value
+	}
+	sort.SliceStable(cands, func(a, b int) bool {
+		return cands[a].before(cands[b])
+	})
+	if strings.EqualFold(value, "null") {
+		return value
+	}
+	return cands[0].rule.rule.Mask(value)
+}
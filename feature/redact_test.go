@@ -0,0 +1,43 @@
+package feature
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	rs, err := NewRuleSet([]DataMaskingRule{
+		{Name: "phone", FieldsPattern: "phone", MaskingMethod: MaskingMethodPhone},
+		{Name: "id_card", FieldsPattern: "id_card", MaskingMethod: MaskingMethodIDCard},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		msg string
+		exp string
+	}{
+		{
+			"Error 1062 (23000): Duplicate entry '13812345678' for key 'users.phone'",
+			"Error 1062 (23000): Duplicate entry '138****5678' for key 'users.phone'",
+		},
+		{
+			"Error 1062 (23000): Duplicate entry '42' for key 'users.PRIMARY'",
+			"Error 1062 (23000): Duplicate entry '***' for key 'users.PRIMARY'",
+		},
+		{
+			"Incorrect integer value: 'abc' for column 'age' at row 1",
+			"Incorrect integer value: 'abc' for column 'age' at row 1",
+		},
+		{
+			`Key (id, phone)=(1, 13812345678) already exists.`,
+			`Key (id, phone)=(1, 138****5678) already exists.`,
+		},
+		{
+			"Failing row contains (1, 13812345678, null).",
+			"Failing row contains (***).",
+		},
+	}
+	for _, test := range tests {
+		if s := rs.Redact(test.msg); s != test.exp {
+			t.Errorf("expected %q, got %q", test.exp, s)
+		}
+	}
+}
@@ -0,0 +1,549 @@
+package feature
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dlclark/regexp2"
+	"github.com/jumpserver-dev/usql/text"
+)
+
+// maxCachedPlans 缓存的脱敏方案数量上限，超过后清空重新缓存
+const maxCachedPlans = 256
+
+// RuleSet 加载时编译好的脱敏规则集合，创建后规则不再变化，可以并发使用
+type RuleSet struct {
+	rules []compiledRule
+
+	// plans 按语句和结果列缓存的脱敏方案
+	mu    sync.Mutex
+	plans map[string]planEntry
+}
+
+// compiledRule 预编译了匹配模式的规则
+type compiledRule struct {
+	rule DataMaskingRule
+	// index 规则在配置中的位置，其他条件都相同时靠前的规则优先
+	index    int
+	fields   patterns
+	database patterns
+	schema   patterns
+	table    patterns
+}
+
+// patterns 编译后的逗号分隔的通配符模式
+type patterns []pattern
+
+// pattern 单个通配符模式，literal 为模式中非通配符的字符数，用于比较模式的具体程度
+type pattern struct {
+	// re 带通配符的模式编译得到的正则，不含通配符的模式为 nil，按 text 忽略大小写比较
+	re   *regexp2.Regexp
+	text string
+	// prefix、suffix 带通配符的模式中第一个 * 之前和最后一个 * 之后的部分，
+	// 匹配正则前先比较，大多数名称在这里就能排除
+	prefix, suffix string
+	exact          bool
+	literal        int
+}
+
+// MaskPlan 一个结果集的脱敏方案，按列下标查找使用的规则
+type MaskPlan struct {
+	rules []*DataMaskingRule
+	// choices 每一列命中的规则及被覆盖的规则，用于调试输出
+	choices []choice
+}
+
+// choice 一列的规则选择结果
+type choice struct {
+	// via 规则匹配到的列名或来源列
+	via        string
+	overridden []*DataMaskingRule
+}
+
+// candidate 匹配到某一列的规则
+type candidate struct {
+	rule *compiledRule
+	// via 匹配到的列名或来源列，direct 表示是否由来源列直接得到
+	via    string
+	direct bool
+	// unresolved 是否因无法确定列的来源而匹配
+	unresolved bool
+	spec       specificity
+}
+
+// specificity 规则对某一列的具体程度
+type specificity struct {
+	// qualifiers 规则限定的库、schema 和表的数量
+	qualifiers int
+	// exact 字段模式不含通配符
+	exact bool
+	// literal 字段模式中非通配符的字符数
+	literal int
+}
+
+type planEntry struct {
+	plan *MaskPlan
+	err  error
+}
+
+// NewRuleSet 校验规则并编译其中的匹配模式和正则，规则有误时返回错误
+func NewRuleSet(rules []DataMaskingRule) (*RuleSet, error) {
+	if err := ValidateRules(rules); err != nil {
+		return nil, err
+	}
+	return newRuleSet(rules, true)
+}
+
+// NewLenientRuleSet 不校验规则，直接编译。无效的规则尽量按原意生效：
+// 无法编译的 regex_replace 规则整体遮盖，未知的脱敏方法输出 MaskPattern
+func NewLenientRuleSet(rules []DataMaskingRule) *RuleSet {
+	rs, _ := newRuleSet(rules, false)
+	return rs
+}
+
+// newRuleSet 编译规则，strict 为 false 时忽略编译错误
+func newRuleSet(rules []DataMaskingRule, strict bool) (*RuleSet, error) {
+	rs := &RuleSet{
+		rules: make([]compiledRule, len(rules)),
+		plans: make(map[string]planEntry),
+	}
+	for i, rule := range rules {
+		if err := rule.Compile(); err != nil && strict {
+			return nil, err
+		}
+		c := compiledRule{rule: rule, index: i}
+		for _, p := range []struct {
+			field string
+			value string
+			dest  *patterns
+		}{
+			{"fields_pattern", rule.FieldsPattern, &c.fields},
+			{"database_pattern", rule.DatabasePattern, &c.database},
+			{"schema_pattern", rule.SchemaPattern, &c.schema},
+			{"table_pattern", rule.TablePattern, &c.table},
+		} {
+			var err error
+			if *p.dest, err = compilePatterns(p.value); err != nil && strict {
+				return nil, fmt.Errorf("masking rule %q: invalid %s %q: %w", rule.Name, p.field, p.value, err)
+			}
+		}
+		rs.rules[i] = c
+	}
+	return rs, nil
+}
+
+// Rules 返回规则集合中的规则
+func (rs *RuleSet) Rules() []DataMaskingRule {
+	rules := make([]DataMaskingRule, len(rs.rules))
+	for i := range rs.rules {
+		rules[i] = rs.rules[i].rule
+	}
+	return rules
+}
+
+// RuleMatch 一条规则匹配到的结果列
+type RuleMatch struct {
+	Rule DataMaskingRule
+	// Columns 使用该规则脱敏的列
+	Columns []string
+	// Overridden 规则匹配但被其他规则覆盖的列
+	Overridden []string
+}
+
+// Explain 返回每条规则在第 set 个结果集中匹配到的列
+func (rs *RuleSet) Explain(d Dialect, sqlstr string, set int, cols []string) ([]RuleMatch, error) {
+	plan, err := rs.Plan(d, sqlstr, set, cols)
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]RuleMatch, len(rs.rules))
+	index := make(map[*DataMaskingRule]int, len(rs.rules))
+	for i := range rs.rules {
+		matches[i].Rule = rs.rules[i].rule
+		index[&rs.rules[i].rule] = i
+	}
+	for j, col := range cols {
+		if rule := plan.Rule(j); rule != nil {
+			m := &matches[index[rule]]
+			m.Columns = append(m.Columns, col)
+			for _, r := range plan.choices[j].overridden {
+				m := &matches[index[r]]
+				m.Overridden = append(m.Overridden, col)
+			}
+		}
+	}
+	return matches, nil
+}
+
+// Plan 返回第 set 个结果集的脱敏方案，相同的语句和结果列直接使用缓存的方案
+func (rs *RuleSet) Plan(d Dialect, sqlstr string, set int, cols []string) (*MaskPlan, error) {
+	key := planKey(d, sqlstr, set, cols)
+	rs.mu.Lock()
+	e, ok := rs.plans[key]
+	rs.mu.Unlock()
+	if ok {
+		return e.plan, e.err
+	}
+	sources := ResolveColumnSources(sqlstr, d, set, cols)
+	plan, err := rs.buildPlan(d, cols, sources)
+	rs.mu.Lock()
+	if len(rs.plans) >= maxCachedPlans {
+		rs.plans = make(map[string]planEntry)
+	}
+	rs.plans[key] = planEntry{plan, err}
+	rs.mu.Unlock()
+	return plan, err
+}
+
+// buildPlan 计算需要脱敏的列及对应的规则。规则既按结果列名匹配，
+// 也按解析语句得到的来源列匹配，避免通过别名或表达式绕过脱敏；
+// 由被脱敏列计算得到的列按规则的 ComputedPolicy 处理。
+//
+// 多条规则匹配同一列时按以下顺序选出一条：
+//  1. 模式更具体的规则优先：限定的库、schema、表更多的优先，
+//     其次字段模式不含通配符的优先，再次字段模式中非通配符字符更多的优先；
+//  2. Priority 更大的规则优先；
+//  3. 脱敏方法更严格（泄露信息更少）的规则优先，keep_prefix、keep_suffix 和
+//     hide_middle 按保留的明文字符数比较，保留得少的优先，其次 min_visible_length 大的优先；
+//  4. 在配置中靠前的规则优先。
+//
+// database/sql 不提供结果列的来源表，库、schema 和表的限定也依赖解析语句，
+// 来源表无法确定时按满足处理，宁可多脱敏也不遗漏。语句无法解析时，
+// 结果列可能取自任意列，按规则的 UnresolvedPolicy 脱敏或拒绝查询
+func (rs *RuleSet) buildPlan(d Dialect, cols []string, sources []ColumnSource) (*MaskPlan, error) {
+	plan := &MaskPlan{
+		rules:   make([]*DataMaskingRule, len(cols)),
+		choices: make([]choice, len(cols)),
+	}
+	for j := range cols {
+		var src ColumnSource
+		if sources != nil {
+			src = sources[j]
+		}
+		var cands []candidate
+		for i := range rs.rules {
+			if cand, ok := rs.rules[i].matchColumn(d, cols[j], src); ok {
+				cands = append(cands, cand)
+			}
+		}
+		if len(cands) == 0 {
+			continue
+		}
+		sort.SliceStable(cands, func(a, b int) bool {
+			return cands[a].before(cands[b])
+		})
+		best := cands[0]
+		switch {
+		case best.unresolved && best.rule.rule.UnresolvedPolicy == UnresolvedPolicyBlock:
+			return nil, fmt.Errorf(text.MaskingSourceUnknown, cols[j], best.rule.rule.Name)
+		case !best.unresolved && !best.direct && best.rule.rule.ComputedPolicy == ComputedPolicyBlock:
+			return nil, fmt.Errorf(text.MaskingColumnBlocked, cols[j], best.via, best.rule.rule.Name)
+		}
+		plan.rules[j] = &best.rule.rule
+		plan.choices[j].via = best.via
+		for _, c := range cands[1:] {
+			plan.choices[j].overridden = append(plan.choices[j].overridden, &c.rule.rule)
+		}
+	}
+	return plan, nil
+}
+
+// matchColumn 判断规则是否匹配结果列，匹配时返回规则对该列的具体程度。
+// 结果列名匹配时直接使用，否则按来源列匹配，来源列为整行时匹配任意字段；
+// 计算列的 ComputedPolicy 为 allow 时不匹配，来源无法确定时规则匹配任意列
+func (c *compiledRule) matchColumn(d Dialect, col string, src ColumnSource) (candidate, bool) {
+	if spec, ok := c.fields.specificity(col); ok && c.matchTables(d, src.Refs) {
+		return c.candidate(col, true, spec), true
+	}
+	if src.Unresolved {
+		cand := c.candidate(allColumns, false, specificity{})
+		cand.unresolved = true
+		return cand, true
+	}
+	var best candidate
+	var found bool
+	for _, ref := range src.Refs {
+		spec, ok := c.fields.specificity(ref.Column)
+		if ref.Column == allColumns {
+			spec, ok = specificity{}, true
+		}
+		if !ok || !c.matchTable(d.SplitTable(ref.Table)) {
+			continue
+		}
+		if !src.Direct && c.rule.ComputedPolicy == ComputedPolicyAllow {
+			continue
+		}
+		via := ref.Column
+		if ref.Table != "" {
+			via = ref.Table + "." + ref.Column
+		}
+		if cand := c.candidate(via, src.Direct, spec); !found || cand.spec.greater(best.spec) {
+			best, found = cand, true
+		}
+	}
+	return best, found
+}
+
+// candidate 构造匹配结果，qualifiers 为规则限定的库、schema 和表的数量
+func (c *compiledRule) candidate(via string, direct bool, spec specificity) candidate {
+	for _, p := range []patterns{c.database, c.schema, c.table} {
+		if p != nil {
+			spec.qualifiers++
+		}
+	}
+	return candidate{rule: c, via: via, direct: direct, spec: spec}
+}
+
+// before 判断 a 是否比 b 优先
+func (a candidate) before(b candidate) bool {
+	switch {
+	case a.spec != b.spec:
+		return a.spec.greater(b.spec)
+	case a.rule.rule.Priority != b.rule.rule.Priority:
+		return a.rule.rule.Priority > b.rule.rule.Priority
+	}
+	if sa, sb := ruleStrictness(a.rule.rule), ruleStrictness(b.rule.rule); sa != sb {
+		return sa.greater(sb)
+	}
+	return a.rule.index < b.rule.index
+}
+
+// greater 判断 s 是否比 t 更具体
+func (s specificity) greater(t specificity) bool {
+	switch {
+	case s.qualifiers != t.qualifiers:
+		return s.qualifiers > t.qualifiers
+	case s.exact != t.exact:
+		return s.exact
+	}
+	return s.literal > t.literal
+}
+
+// strictness 规则的严格程度
+type strictness struct {
+	// level 脱敏方法的严格程度，值越大泄露的信息越少
+	level int
+	// visible 保留部分明文的方法保留的字符数，minVisible 为 min_visible_length
+	visible    int
+	minVisible int
+}
+
+// ruleStrictness 返回规则的严格程度。未知方法输出固定的 MaskPattern，按最严格处理；
+// keep_prefix、keep_suffix 和 hide_middle 属于同一级别，按参数计算保留的字符数
+func ruleStrictness(r DataMaskingRule) strictness {
+	p := r.Params
+	switch r.MaskingMethod {
+	case MaskingMethodHash, MaskingMethodTokenize:
+		return strictness{level: 4}
+	case MaskingMethodEmail, MaskingMethodPhone, MaskingMethodIDCard, MaskingMethodBankCard, MaskingMethodIP:
+		return strictness{level: 3}
+	case MaskingMethodKeepPrefix:
+		return strictness{level: 2, visible: p.prefix(defaultKeepLength), minVisible: p.MinVisibleLength}
+	case MaskingMethodKeepSuffix:
+		return strictness{level: 2, visible: p.suffix(defaultKeepLength), minVisible: p.MinVisibleLength}
+	case MaskingMethodHideMiddle:
+		return strictness{level: 2, visible: p.prefix(defaultMiddleLength) + p.suffix(defaultMiddleLength), minVisible: p.MinVisibleLength}
+	case MaskingMethodRegex:
+		return strictness{level: 1}
+	}
+	return strictness{level: 5}
+}
+
+// greater 判断 s 是否比 t 更严格
+func (s strictness) greater(t strictness) bool {
+	switch {
+	case s.level != t.level:
+		return s.level > t.level
+	case s.visible != t.visible:
+		return s.visible < t.visible
+	}
+	return s.minVisible > t.minVisible
+}
+
+// matchTables 判断列的任意一个来源表是否满足规则的表限定，来源未知时视为满足
+func (c *compiledRule) matchTables(d Dialect, refs []ColumnRef) bool {
+	if len(refs) == 0 {
+		return true
+	}
+	for _, ref := range refs {
+		if c.matchTable(d.SplitTable(ref.Table)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTable 判断来源表是否满足规则的库、schema 和表匹配模式，无法确定的部分视为满足
+func (c *compiledRule) matchTable(t TableName) bool {
+	match := func(p patterns, name string) bool {
+		return p == nil || name == "" || p.match(name)
+	}
+	return match(c.database, t.Database) &&
+		match(c.schema, t.Schema) &&
+		match(c.table, t.Table)
+}
+
+// Rule 返回第 i 列使用的规则，不需要脱敏时返回 nil
+func (p *MaskPlan) Rule(i int) *DataMaskingRule {
+	if p == nil || i >= len(p.rules) {
+		return nil
+	}
+	return p.rules[i]
+}
+
+// Explain 返回每个脱敏列命中的规则及被覆盖的规则的说明
+func (p *MaskPlan) Explain(cols []string) []string {
+	if p == nil {
+		return nil
+	}
+	var lines []string
+	for i, rule := range p.rules {
+		if rule == nil || i >= len(cols) {
+			continue
+		}
+		c := p.choices[i]
+		line := fmt.Sprintf("column %q: rule %q (%s", cols[i], rule.Name, rule.MaskingMethod)
+		if c.via != cols[i] {
+			line += ", via " + c.via
+		}
+		line += ")"
+		if len(c.overridden) != 0 {
+			names := make([]string, len(c.overridden))
+			for k, r := range c.overridden {
+				names[k] = strconv.Quote(r.Name)
+			}
+			line += ", overrides " + strings.Join(names, ", ")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// compilePatterns 将逗号分隔的通配符模式编译为忽略大小写的整串匹配，
+// 只有带通配符的模式编译为正则
+func compilePatterns(s string) (patterns, error) {
+	var ps patterns
+	for _, raw := range strings.Split(s, ",") {
+		p := strings.TrimSpace(raw)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "*") {
+			ps = append(ps, pattern{text: p, exact: true, literal: len([]rune(p))})
+			continue
+		}
+		re, err := regexp2.Compile(wildcardToRegexAnchored(p), regexp2.RE2|regexp2.IgnoreCase)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, pattern{
+			re:      re,
+			prefix:  p[:strings.IndexByte(p, '*')],
+			suffix:  p[strings.LastIndexByte(p, '*')+1:],
+			literal: len([]rune(strings.ReplaceAll(p, "*", ""))),
+		})
+	}
+	return ps, nil
+}
+
+// match 判断 name 是否匹配任意一个模式
+func (ps patterns) match(name string) bool {
+	_, ok := ps.specificity(name)
+	return ok
+}
+
+// specificity 返回匹配 name 的模式中最具体的一个的具体程度
+func (ps patterns) specificity(name string) (specificity, bool) {
+	var spec specificity
+	var found bool
+	for _, p := range ps {
+		if !p.match(name) {
+			continue
+		}
+		if s := (specificity{exact: p.exact, literal: p.literal}); !found || s.greater(spec) {
+			spec, found = s, true
+		}
+	}
+	return spec, found
+}
+
+// match 判断 name 是否与模式整串匹配
+func (p pattern) match(name string) bool {
+	if p.re == nil {
+		return strings.EqualFold(p.text, name)
+	}
+	if !hasPrefixFold(name, p.prefix) || !hasSuffixFold(name, p.suffix) {
+		return false
+	}
+	matched, err := p.re.MatchString(name)
+	return err == nil && matched
+}
+
+// hasPrefixFold 判断 s 是否以 prefix 开头，忽略大小写
+func hasPrefixFold(s, prefix string) bool {
+	for _, r := range prefix {
+		c, n := utf8.DecodeRuneInString(s)
+		if n == 0 || !equalFold(c, r) {
+			return false
+		}
+		s = s[n:]
+	}
+	return true
+}
+
+// hasSuffixFold 判断 s 是否以 suffix 结尾，忽略大小写
+func hasSuffixFold(s, suffix string) bool {
+	for suffix != "" {
+		r, m := utf8.DecodeLastRuneInString(suffix)
+		c, n := utf8.DecodeLastRuneInString(s)
+		if n == 0 || !equalFold(c, r) {
+			return false
+		}
+		s, suffix = s[:len(s)-n], suffix[:len(suffix)-m]
+	}
+	return true
+}
+
+// equalFold 判断两个字符在忽略大小写时是否相同
+func equalFold(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
+
+// 将带通配符的模式，转成安全的正则，并加上 ^...$
+func wildcardToRegexAnchored(p string) string {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return "^$"
+	}
+	// 先把用户输入整体转义，避免正则元字符被误用
+	esc := regexp.QuoteMeta(p) // 例如 "." 会变成 "\."
+	// 再把被转义的 "\*" 还原为 ".*" 以实现通配符
+	esc = strings.ReplaceAll(esc, `\*`, ".*")
+	// 最终加锚点，做到"整串匹配"
+	return "^" + esc + "$"
+}
+
+// planKey 由方言、语句、结果集序号和列名组成的缓存键
+func planKey(d Dialect, sqlstr string, set int, cols []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v\x00%d\x00%s", d, set, sqlstr)
+	for _, c := range cols {
+		b.WriteByte(0)
+		b.WriteString(c)
+	}
+	return b.String()
+}
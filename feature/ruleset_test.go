@@ -0,0 +1,226 @@
+package feature
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dlclark/regexp2"
+)
+
+func TestPatternsMatch(t *testing.T) {
+	tests := []struct {
+		patterns string
+		name     string
+		exp      bool
+	}{
+		{"phone", "phone", true},
+		{"phone", "PHONE", true},
+		{"phone", "phones", false},
+		{"phone, mobile", "Mobile", true},
+		{"user.phone", "user_phone", false},
+		{"ph*", "Phone", true},
+		{"*phone", "home_phone", true},
+		{"*phone", "phone_no", false},
+		{"ph*ne", "PH_NE", true},
+		{"ab*ba", "aba", false},
+		{"*", "anything", true},
+		{"*_id", "id", false},
+		{"k*", "\u212aey", true},
+		{"*ße", "STRAßE", true},
+		{"手机*", "手机号", true},
+		{"*号", "手机号", true},
+		{"*号", "手机", false},
+	}
+	for _, test := range tests {
+		ps, err := compilePatterns(test.patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok := ps.match(test.name); ok != test.exp {
+			t.Errorf("%q: %q: expected %t, got %t", test.patterns, test.name, test.exp, ok)
+		}
+	}
+}
+
+func TestPlanResolutionOrder(t *testing.T) {
+	rule := func(name, fields string, method string) DataMaskingRule {
+		return DataMaskingRule{Name: name, FieldsPattern: fields, MaskingMethod: method}
+	}
+	tests := []struct {
+		name string
+		a, b DataMaskingRule
+		exp  string
+	}{
+		{
+			"table qualifier",
+			DataMaskingRule{Name: "a", FieldsPattern: "phone", MaskingMethod: MaskingMethodHash, Priority: 10},
+			DataMaskingRule{Name: "b", FieldsPattern: "phone", TablePattern: "customers", MaskingMethod: MaskingMethodHideMiddle},
+			"b",
+		},
+		{
+			"exact field",
+			DataMaskingRule{Name: "a", FieldsPattern: "phon*", MaskingMethod: MaskingMethodHash, Priority: 10},
+			rule("b", "phone", MaskingMethodHideMiddle),
+			"b",
+		},
+		{
+			"longer literal",
+			rule("a", "*", MaskingMethodHash),
+			rule("b", "ph*", MaskingMethodHideMiddle),
+			"b",
+		},
+		{
+			"priority",
+			rule("a", "phone", MaskingMethodHash),
+			DataMaskingRule{Name: "b", FieldsPattern: "phone", MaskingMethod: MaskingMethodHideMiddle, Priority: 1},
+			"b",
+		},
+		{
+			"stricter method",
+			rule("a", "phone", MaskingMethodHideMiddle),
+			rule("b", "phone", MaskingMethodHash),
+			"b",
+		},
+		{
+			"unknown method is strictest",
+			rule("a", "phone", MaskingMethodHash),
+			DataMaskingRule{Name: "b", FieldsPattern: "phone", MaskingMethod: MaskingMethodFixedChar, MaskPattern: "***"},
+			"b",
+		},
+		{
+			"fewer visible characters",
+			DataMaskingRule{Name: "a", FieldsPattern: "phone", MaskingMethod: MaskingMethodKeepPrefix, Params: MaskingParams{PrefixLength: intPtr(10)}},
+			rule("b", "phone", MaskingMethodHideMiddle),
+			"b",
+		},
+		{
+			"fewer visible characters across methods",
+			DataMaskingRule{Name: "a", FieldsPattern: "phone", MaskingMethod: MaskingMethodHideMiddle, Params: MaskingParams{PrefixLength: intPtr(3), SuffixLength: intPtr(4)}},
+			rule("b", "phone", MaskingMethodKeepSuffix),
+			"b",
+		},
+		{
+			"larger min visible length",
+			rule("a", "phone", MaskingMethodKeepPrefix),
+			DataMaskingRule{Name: "b", FieldsPattern: "phone", MaskingMethod: MaskingMethodKeepPrefix, Params: MaskingParams{MinVisibleLength: 8}},
+			"b",
+		},
+		{
+			"position",
+			rule("a", "phone", MaskingMethodKeepPrefix),
+			rule("b", "phone", MaskingMethodKeepSuffix),
+			"a",
+		},
+	}
+	d := DialectFor("postgres")
+	for _, test := range tests {
+		// 两种顺序下都应选出同一条规则，位置只在其他条件都相同时起作用
+		orders := [][]DataMaskingRule{{test.a, test.b}, {test.b, test.a}}
+		if test.exp == "a" {
+			orders = orders[:1]
+		}
+		for _, rules := range orders {
+			rs, err := NewRuleSet(rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plan, err := rs.Plan(d, "SELECT phone FROM customers", 0, []string{"phone"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rule := plan.Rule(0); rule == nil || rule.Name != test.exp {
+				t.Errorf("%s: expected rule %q, got %+v", test.name, test.exp, rule)
+			}
+		}
+	}
+}
+
+// BenchmarkPlan 比较引入规则集合前的实现、首次计算脱敏方案与使用缓存的方案的耗时，
+// 结果集有 200 列，规则集合有 50 条规则
+func BenchmarkPlan(b *testing.B) {
+	cols := make([]string, 200)
+	for i := range cols {
+		cols[i] = fmt.Sprintf("col_%d", i)
+	}
+	sqlstr := "SELECT " + strings.Join(cols, ", ") + " FROM app.customers c JOIN app.orders o ON o.customer_id = c.id WHERE c.id > 10"
+	rules := make([]DataMaskingRule, 50)
+	for i := range rules {
+		rules[i] = DataMaskingRule{
+			Name:          fmt.Sprintf("rule_%d", i),
+			FieldsPattern: fmt.Sprintf("col_%d, col_%d*, *_%d", i, i%10, i+100),
+			MaskingMethod: MaskingMethodHideMiddle,
+			Priority:      i % 3,
+		}
+		if i%2 == 0 {
+			rules[i].TablePattern = "customers"
+		}
+	}
+	rs, err := NewRuleSet(rules)
+	if err != nil {
+		b.Fatal(err)
+	}
+	d := DialectFor("postgres")
+	b.Run("baseline", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			baselinePlan(rules, cols)
+		}
+	})
+	b.Run("cold", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rs.mu.Lock()
+			rs.plans = make(map[string]planEntry)
+			rs.mu.Unlock()
+			if _, err := rs.Plan(d, sqlstr, 0, cols); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		if _, err := rs.Plan(d, sqlstr, 0, cols); err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := rs.Plan(d, sqlstr, 0, cols); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// baselinePlan 重现引入规则集合前的实现：每次查询对每一列、每条规则重新编译字段模式，
+// 只作为 BenchmarkPlan 的对照
+func baselinePlan(rules []DataMaskingRule, cols []string) []*DataMaskingRule {
+	plan := make([]*DataMaskingRule, len(cols))
+	for i, col := range cols {
+		for j := range rules {
+			if baselineMatch(rules[j].FieldsPattern, col) {
+				plan[i] = &rules[j]
+				break
+			}
+		}
+	}
+	return plan
+}
+
+// baselineMatch 逐个编译逗号分隔的模式并匹配 name
+func baselineMatch(patterns, name string) bool {
+	for _, raw := range strings.Split(patterns, ",") {
+		p := strings.TrimSpace(raw)
+		if p == "" {
+			continue
+		}
+		re, err := regexp2.Compile(wildcardToRegexAnchored(p), regexp2.RE2|regexp2.IgnoreCase)
+		if err != nil {
+			continue
+		}
+		if matched, err := re.MatchString(name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,968 @@
+package feature
+
+import (
+	"strings"
+)
+
+// ColumnRef 结果列引用到的来源列
+type ColumnRef struct {
+	// Table 来源表，可能带有库名或 schema，例如 crm.customers；无法确定时为空
+	Table string
+	// Column 来源列名
+	Column string
+}
+
+// ColumnSource 结果列与来源列的对应关系
+type ColumnSource struct {
+	// Refs 结果列的值所依赖的来源列
+	Refs []ColumnRef
+	// Direct 结果列是否直接取自来源列（可能是别名），为 false 时表示由表达式计算得到
+	Direct bool
+	// Unresolved 无法解析语句确定结果列的来源，结果列可能取自任意表的任意列
+	Unresolved bool
+}
+
+// allColumns 表示来源表的所有列，用于整行引用或无法确定对应哪一列的情况
+const allColumns = "*"
+
+// Dialect 解析语句时使用的方言设置
+type Dialect struct {
+	// BackslashEscapes 字符串中是否使用反斜杠转义（MySQL）
+	BackslashEscapes bool
+	// HashComments 是否支持 # 单行注释（MySQL）
+	HashComments bool
+	// SchemaIsDatabase 库和 schema 是否为同一概念（MySQL），此时 a.b 中的 a 既是库也是 schema
+	SchemaIsDatabase bool
+	// ExecutableComments 是否执行 /*! ... */ 注释中的内容（MySQL）
+	ExecutableComments bool
+	// RowReferences 表别名是否可以引用整行（PostgreSQL），例如 SELECT to_json(c) FROM customers c
+	RowReferences bool
+	// DollarQuotes 是否支持 $$ ... $$ 和 $tag$ ... $tag$ 字符串（PostgreSQL）
+	DollarQuotes bool
+	// EscapeStrings 是否支持使用反斜杠转义的 E'...' 字符串（PostgreSQL）
+	EscapeStrings bool
+	// AmbiguousEscapes 服务端设置是否会改变普通字符串中反斜杠的含义，例如 MySQL 的
+	// NO_BACKSLASH_ESCAPES、PostgreSQL 的 standard_conforming_strings
+	AmbiguousEscapes bool
+}
+
+// TableName 拆分后的表名，无法确定的部分为空
+type TableName struct {
+	Database string
+	Schema   string
+	Table    string
+}
+
+// SplitTable 按方言拆分来源表的限定名
+func (d Dialect) SplitTable(name string) TableName {
+	parts := strings.Split(name, ".")
+	switch len(parts) {
+	case 1:
+		return TableName{Table: parts[0]}
+	case 2:
+		if d.SchemaIsDatabase {
+			return TableName{Database: parts[0], Schema: parts[0], Table: parts[1]}
+		}
+		return TableName{Schema: parts[0], Table: parts[1]}
+	}
+	n := len(parts)
+	return TableName{Database: parts[n-3], Schema: parts[n-2], Table: parts[n-1]}
+}
+
+// DialectFor 返回驱动对应的方言设置
+func DialectFor(driver string) Dialect {
+	switch driver {
+	case "mysql", "memsql", "vitess", "tidb":
+		return Dialect{BackslashEscapes: true, HashComments: true, SchemaIsDatabase: true, ExecutableComments: true, AmbiguousEscapes: true}
+	case "postgres", "pgx":
+		return Dialect{RowReferences: true, DollarQuotes: true, EscapeStrings: true, AmbiguousEscapes: true}
+	}
+	return Dialect{RowReferences: true}
+}
+
+// ResolveColumnSources 解析查询语句，返回第 set 个结果集中与结果列 cols 一一对应的来源。
+// 包含多条语句时，按顺序将返回结果的查询语句与结果集对应。
+// 只包含 SHOW 等不读取表数据的语句时返回 nil，调用方此时只按结果列名匹配规则；
+// 语句无法解析、与结果集对不上、切分结果依赖服务端设置或引用了用户变量时，
+// 每一列的来源都标记为 Unresolved
+func ResolveColumnSources(sqlstr string, d Dialect, set int, cols []string) []ColumnSource {
+	toks := tokenize(sqlstr, d)
+	if ambiguous(sqlstr, d, toks) || hasUserVariables(toks) {
+		return unresolved(cols)
+	}
+	var queries [][]token
+	var opaque bool
+	for _, stmt := range splitStatements(toks) {
+		switch first := leadingWord(stmt); {
+		case first.is("SELECT", "WITH"):
+			queries = append(queries, stmt)
+		case !first.is(metadataWords...):
+			// CALL、EXECUTE、带 RETURNING 的 DML 等语句也可能返回表中的数据
+			opaque = true
+		}
+	}
+	if !opaque && len(queries) == 0 {
+		return nil
+	}
+	if opaque || set >= len(queries) {
+		return unresolved(cols)
+	}
+	items, ok := parseQuery(queries[set], d, nil)
+	if !ok {
+		return unresolved(cols)
+	}
+	if sources := expandItems(items, cols); sources != nil {
+		return sources
+	}
+	return unresolved(cols)
+}
+
+// metadataWords 只返回元数据、不读取表数据的语句
+var metadataWords = []string{"SHOW", "DESCRIBE", "DESC", "EXPLAIN", "HELP"}
+
+// unresolved 返回来源都无法确定的结果列
+func unresolved(cols []string) []ColumnSource {
+	sources := make([]ColumnSource, len(cols))
+	for i := range sources {
+		sources[i].Unresolved = true
+	}
+	return sources
+}
+
+// ambiguous 判断按服务端的另一种字符串转义设置切分语句时结果是否不同，
+// 不同时无法确定服务端看到的语句结构
+func ambiguous(sqlstr string, d Dialect, toks []token) bool {
+	if !d.AmbiguousEscapes {
+		return false
+	}
+	alt := d
+	alt.BackslashEscapes = !d.BackslashEscapes
+	other := tokenize(sqlstr, alt)
+	if len(other) != len(toks) {
+		return true
+	}
+	for i := range toks {
+		if toks[i] != other[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// hasUserVariables 判断语句是否引用了 @name 形式的用户变量或参数。
+// 变量的值可能在其他语句中取自任意列，例如 SELECT phone INTO @p FROM users; SELECT @p
+func hasUserVariables(toks []token) bool {
+	for _, t := range toks {
+		if t.kind == tokWord && len(t.val) > 1 && t.val[0] == '@' && t.val[1] != '@' {
+			return true
+		}
+	}
+	return false
+}
+
+// leadingWord 返回语句中第一个不是左括号的 token
+func leadingWord(toks []token) token {
+	for _, t := range toks {
+		if !t.punct("(") {
+			return t
+		}
+	}
+	return token{}
+}
+
+// ---------------- 词法分析 ----------------
+
+type tokenKind int
+
+const (
+	tokWord   tokenKind = iota // 未加引号的标识符或关键字
+	tokIdent                   // 加引号的标识符
+	tokString                  // 字符串常量
+	tokNumber                  // 数字常量
+	tokPunct                   // 标点和运算符
+)
+
+type token struct {
+	kind tokenKind
+	val  string
+}
+
+// is 判断 token 是否为指定的关键字（不区分大小写）
+func (t token) is(words ...string) bool {
+	if t.kind != tokWord {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(t.val, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// punct 判断 token 是否为指定的标点
+func (t token) punct(s string) bool {
+	return t.kind == tokPunct && t.val == s
+}
+
+// isName 判断 token 是否可以作为标识符使用
+func (t token) isName() bool {
+	return t.kind == tokIdent || t.kind == tokWord && !reserved[strings.ToUpper(t.val)]
+}
+
+// tokenize 将语句切分为 token，忽略空白和注释。
+// 方言支持时 /*! ... */ 中的内容按语句的一部分切分
+func tokenize(s string, d Dialect) []token {
+	var toks []token
+	// executable 是否在 /*! ... */ 中
+	var executable bool
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case c == '-' && strings.HasPrefix(s[i:], "--"), c == '#' && d.HashComments:
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case executable && c == '*' && strings.HasPrefix(s[i:], "*/"):
+			executable = false
+			i += 2
+		case d.ExecutableComments && c == '/' && (strings.HasPrefix(s[i:], "/*!") || strings.HasPrefix(s[i:], "/*M!")):
+			// /*!50100 ... */ 或 MariaDB 的 /*M!100100 ... */，跳过版本号
+			i += strings.IndexByte(s[i:], '!') + 1
+			for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+				i++
+			}
+			executable = true
+		case c == '/' && strings.HasPrefix(s[i:], "/*"):
+			if j := strings.Index(s[i+2:], "*/"); j != -1 {
+				i += j + 4
+			} else {
+				i = len(s)
+			}
+		case c == '\'':
+			j := scanQuoted(s, i, '\'', d.BackslashEscapes)
+			toks = append(toks, token{tokString, s[i:j]})
+			i = j
+		case d.EscapeStrings && (c == 'E' || c == 'e') && i+1 < len(s) && s[i+1] == '\'':
+			// E'...' 中总是使用反斜杠转义
+			j := scanQuoted(s, i+1, '\'', true)
+			toks = append(toks, token{tokString, s[i:j]})
+			i = j
+		case d.DollarQuotes && c == '$' && dollarTag(s[i:]) != "":
+			tag := dollarTag(s[i:])
+			j := len(s)
+			if k := strings.Index(s[i+len(tag):], tag); k != -1 {
+				j = i + len(tag) + k + len(tag)
+			}
+			toks = append(toks, token{tokString, s[i:j]})
+			i = j
+		case c == '"' && d.BackslashEscapes:
+			// MySQL 中双引号默认为字符串，开启 ANSI_QUOTES 时为标识符，按标识符处理以便匹配规则
+			j := scanQuoted(s, i, c, true)
+			toks = append(toks, token{tokIdent, unquote(s[i:j], c, c)})
+			i = j
+		case c == '"' || c == '`':
+			j := scanQuoted(s, i, c, false)
+			toks = append(toks, token{tokIdent, unquote(s[i:j], c, c)})
+			i = j
+		case c == '[':
+			j := scanQuoted(s, i, ']', false)
+			toks = append(toks, token{tokIdent, unquote(s[i:j], '[', ']')})
+			i = j
+		case isDigit(c):
+			j := i
+			for j < len(s) && (isDigit(s[j]) || s[j] == '.' || s[j] == 'e' || s[j] == 'E' || s[j] == 'x' || s[j] == 'X') {
+				j++
+			}
+			toks = append(toks, token{tokNumber, s[i:j]})
+			i = j
+		case isWordByte(c):
+			j := i
+			for j < len(s) && (isWordByte(s[j]) || isDigit(s[j])) {
+				j++
+			}
+			toks = append(toks, token{tokWord, s[i:j]})
+			i = j
+		default:
+			toks = append(toks, token{tokPunct, string(c)})
+			i++
+		}
+	}
+	return toks
+}
+
+// scanQuoted 返回从 i 开始、以 end 结束的引用串的结束位置，重复的结束符视为转义
+func scanQuoted(s string, i int, end byte, backslash bool) int {
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case backslash && s[j] == '\\':
+			j++
+		case s[j] == end && j+1 < len(s) && s[j+1] == end:
+			j++
+		case s[j] == end:
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+// dollarTag 返回 s 开头的 $$ 或 $tag$ 形式的字符串起始标记，不是时返回空串。
+// $1 等位置参数不是起始标记
+func dollarTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		switch c := s[j]; {
+		case c == '$':
+			return s[:j+1]
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 || j > 1 && isDigit(c):
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// unquote 去掉标识符两侧的引号
+func unquote(s string, start, end byte) string {
+	s = strings.TrimPrefix(s, string(start))
+	s = strings.TrimSuffix(s, string(end))
+	return strings.ReplaceAll(s, string(end)+string(end), string(end))
+}
+
+// isWordByte 判断是否为标识符可用的字符，非 ASCII 字符都视为标识符的一部分
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// isDigit 判断是否为数字
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// reserved 不能作为列别名或表别名的关键字
+var reserved = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`ALL AND ANY AS ASC BETWEEN BY CASE CROSS DESC DISTINCT ELSE END
+		EXCEPT EXISTS FETCH FOR FROM FULL GROUP HAVING IN INNER INTERSECT INTERVAL INTO IS JOIN
+		LATERAL LEFT LIKE LIMIT MINUS NATURAL NOT NULL OFFSET ON OR ORDER OUTER OVER PARTITION
+		RETURNING RIGHT SELECT STRAIGHT_JOIN THEN TOP UNION USING WHEN WHERE WINDOW WITH`) {
+		reserved[w] = true
+	}
+}
+
+// ---------------- 语法分析 ----------------
+
+// selectItem 查询中的一个输出项
+type selectItem struct {
+	// name 输出列名（别名或列名），星号项为空
+	name string
+	// star 是否为 * 或 t.*
+	star bool
+	// starTables 星号项展开的来源表
+	starTables []tableRef
+	// source 输出项的来源
+	source ColumnSource
+}
+
+// tableRef FROM 子句中的一个表
+type tableRef struct {
+	// alias 引用该表使用的名称
+	alias string
+	// name 表的完整名称，派生表为空
+	name string
+	// derived 派生表或 CTE 的输出项
+	derived   []selectItem
+	isDerived bool
+}
+
+// parseQuery 解析一个查询（可以包含 WITH 和 UNION），返回输出项
+func parseQuery(toks []token, d Dialect, ctes map[string][]selectItem) ([]selectItem, bool) {
+	toks = trimParens(toks)
+	if len(toks) == 0 {
+		return nil, false
+	}
+	if toks[0].is("WITH") {
+		var ok bool
+		if toks, ctes, ok = parseWith(toks[1:], d, ctes); !ok {
+			return nil, false
+		}
+	}
+	var result []selectItem
+	for i, branch := range splitTop(toks, "UNION", "INTERSECT", "EXCEPT", "MINUS") {
+		// 去掉 UNION ALL / UNION DISTINCT 中的修饰词
+		for len(branch) > 0 && branch[0].is("ALL", "DISTINCT") {
+			branch = branch[1:]
+		}
+		items, ok := parseBranch(trimParens(branch), d, ctes)
+		if !ok {
+			return nil, false
+		}
+		if i == 0 {
+			result = items
+			continue
+		}
+		if len(items) != len(result) {
+			return nil, false
+		}
+		// 后续分支的值也会出现在同一列中
+		for j := range result {
+			result[j].star = result[j].star || items[j].star
+			result[j].starTables = append(result[j].starTables, items[j].starTables...)
+			result[j].source.Refs = append(result[j].source.Refs, items[j].source.Refs...)
+			result[j].source.Direct = result[j].source.Direct && items[j].source.Direct
+		}
+	}
+	return result, true
+}
+
+// parseBranch 解析 UNION 的一个分支，分支可以是带括号的查询后跟 ORDER BY、LIMIT 等子句，
+// 例如 (SELECT ...) LIMIT 1
+func parseBranch(toks []token, d Dialect, ctes map[string][]selectItem) ([]selectItem, bool) {
+	if len(toks) > 0 && toks[0].punct("(") {
+		end := matchParen(toks, 0)
+		if rest := toks[end+1:]; len(rest) != 0 && rest[0].is("ORDER", "LIMIT", "OFFSET", "FETCH") {
+			return parseQuery(toks[1:end], d, ctes)
+		}
+	}
+	return parseSelect(toks, d, ctes)
+}
+
+// parseWith 解析 WITH 子句，返回主查询和 CTE 的输出项
+func parseWith(toks []token, d Dialect, ctes map[string][]selectItem) ([]token, map[string][]selectItem, bool) {
+	m := make(map[string][]selectItem, len(ctes)+1)
+	for k, v := range ctes {
+		m[k] = v
+	}
+	if len(toks) > 0 && toks[0].is("RECURSIVE") {
+		toks = toks[1:]
+	}
+	for {
+		if len(toks) < 3 || !toks[0].isName() {
+			return nil, nil, false
+		}
+		name := strings.ToLower(toks[0].val)
+		toks = toks[1:]
+		// 可选的列名列表
+		var colNames []string
+		if toks[0].punct("(") {
+			end := matchParen(toks, 0)
+			for _, t := range toks[1:end] {
+				if t.isName() {
+					colNames = append(colNames, t.val)
+				}
+			}
+			toks = toks[end+1:]
+		}
+		if len(toks) < 2 || !toks[0].is("AS") || !toks[1].punct("(") {
+			return nil, nil, false
+		}
+		end := matchParen(toks, 1)
+		items, ok := parseQuery(toks[2:end], d, m)
+		if !ok {
+			return nil, nil, false
+		}
+		if len(colNames) == len(items) {
+			for i := range items {
+				items[i].name = colNames[i]
+			}
+		}
+		m[name] = items
+		toks = toks[end+1:]
+		if len(toks) == 0 || !toks[0].punct(",") {
+			return toks, m, true
+		}
+		toks = toks[1:]
+	}
+}
+
+// parseSelect 解析单个 SELECT 语句
+func parseSelect(toks []token, d Dialect, ctes map[string][]selectItem) ([]selectItem, bool) {
+	if len(toks) == 0 || !toks[0].is("SELECT") {
+		return nil, false
+	}
+	toks = toks[1:]
+	// 跳过 DISTINCT、TOP n 和 MySQL 的 SQL_* 修饰词
+	for len(toks) > 0 {
+		switch {
+		case toks[0].is("DISTINCT") && len(toks) > 2 && toks[1].is("ON") && toks[2].punct("("):
+			// postgres DISTINCT ON (...)
+			toks = toks[matchParen(toks, 2)+1:]
+			continue
+		case toks[0].is("ALL", "DISTINCT", "DISTINCTROW", "HIGH_PRIORITY", "STRAIGHT_JOIN"),
+			toks[0].kind == tokWord && strings.HasPrefix(strings.ToUpper(toks[0].val), "SQL_"):
+			toks = toks[1:]
+			continue
+		case toks[0].is("TOP") && len(toks) > 1:
+			toks = toks[2:]
+			continue
+		}
+		break
+	}
+	// 输出列表到 FROM（或语句结束）为止
+	end := indexTop(toks, "FROM", "INTO", "WHERE", "GROUP", "HAVING", "ORDER", "LIMIT", "WINDOW", "FOR", "OFFSET", "FETCH")
+	list := toks[:end]
+	var tables []tableRef
+	if end < len(toks) && toks[end].is("FROM") {
+		rest := toks[end+1:]
+		rest = rest[:indexTop(rest, "WHERE", "GROUP", "HAVING", "ORDER", "LIMIT", "WINDOW", "FOR", "OFFSET", "FETCH")]
+		var ok bool
+		if tables, ok = parseFrom(rest, d, ctes); !ok {
+			return nil, false
+		}
+	}
+	var items []selectItem
+	for _, expr := range splitComma(list) {
+		if len(expr) == 0 {
+			return nil, false
+		}
+		items = append(items, parseItem(expr, tables, d, ctes))
+	}
+	return items, len(items) != 0
+}
+
+// parseFrom 解析 FROM 子句中的表
+func parseFrom(toks []token, d Dialect, ctes map[string][]selectItem) ([]tableRef, bool) {
+	var tables []tableRef
+	for i := 0; i < len(toks); {
+		t := toks[i]
+		switch {
+		case t.punct(","), t.is("JOIN", "INNER", "LEFT", "RIGHT", "FULL", "OUTER", "CROSS", "NATURAL", "LATERAL", "STRAIGHT_JOIN"):
+			i++
+			continue
+		case t.is("ON", "USING"):
+			// 跳过连接条件
+			i++
+			for i < len(toks) && !toks[i].punct(",") && !toks[i].is("JOIN", "INNER", "LEFT", "RIGHT", "FULL", "CROSS", "NATURAL", "STRAIGHT_JOIN") {
+				if toks[i].punct("(") {
+					i = matchParen(toks, i)
+				}
+				i++
+			}
+			continue
+		}
+		var ref tableRef
+		switch {
+		case t.punct("("):
+			end := matchParen(toks, i)
+			items, ok := parseQuery(toks[i+1:end], d, ctes)
+			if !ok {
+				// 括号中是表连接而不是子查询
+				inner, ok := parseFrom(toks[i+1:end], d, ctes)
+				if !ok {
+					return nil, false
+				}
+				tables = append(tables, inner...)
+				i = end + 1
+				continue
+			}
+			ref = tableRef{derived: items, isDerived: true}
+			i = end + 1
+		case t.isName():
+			name, next := qualifiedName(toks, i)
+			ref = tableRef{name: name, alias: lastPart(name)}
+			if items, ok := ctes[strings.ToLower(name)]; ok {
+				ref = tableRef{alias: name, derived: items, isDerived: true}
+			}
+			i = next
+			// 表函数，例如 unnest(...)
+			if i < len(toks) && toks[i].punct("(") {
+				i = matchParen(toks, i) + 1
+				ref = tableRef{alias: ref.alias, isDerived: true}
+			}
+		default:
+			return nil, false
+		}
+		// 别名
+		if i < len(toks) && toks[i].is("AS") {
+			i++
+		}
+		if i < len(toks) && toks[i].isName() {
+			ref.alias = toks[i].val
+			i++
+			// 列名列表
+			if i < len(toks) && toks[i].punct("(") {
+				end := matchParen(toks, i)
+				var names []string
+				for _, t := range toks[i+1 : end] {
+					if t.isName() {
+						names = append(names, t.val)
+					}
+				}
+				ref = renameColumns(ref, names)
+				i = end + 1
+			}
+		}
+		tables = append(tables, ref)
+		// 跳过表提示等其余部分，直到下一个表
+		for i < len(toks) && !toks[i].punct(",") && !toks[i].is("JOIN", "INNER", "LEFT", "RIGHT", "FULL", "CROSS", "NATURAL", "STRAIGHT_JOIN", "ON", "USING") {
+			if toks[i].punct("(") {
+				i = matchParen(toks, i)
+			}
+			i++
+		}
+	}
+	return tables, true
+}
+
+// renameColumns 按 FROM 子句中的列名列表重命名表的列。
+// 不知道基本表的列顺序，重命名的列可能取自表中的任意一列，未重命名的列保持原名
+func renameColumns(ref tableRef, names []string) tableRef {
+	if ref.isDerived {
+		if len(names) == len(ref.derived) {
+			for j := range ref.derived {
+				ref.derived[j].name = names[j]
+			}
+		}
+		return ref
+	}
+	base := ref
+	ref = tableRef{alias: base.alias, isDerived: true}
+	for _, name := range names {
+		ref.derived = append(ref.derived, selectItem{
+			name:   name,
+			source: ColumnSource{Refs: []ColumnRef{{Table: base.name, Column: allColumns}}, Direct: true},
+		})
+	}
+	ref.derived = append(ref.derived, selectItem{star: true, starTables: []tableRef{base}, source: ColumnSource{Direct: true}})
+	return ref
+}
+
+// parseItem 解析输出列表中的一项
+func parseItem(expr []token, tables []tableRef, d Dialect, ctes map[string][]selectItem) selectItem {
+	// * 或 t.*
+	if last := expr[len(expr)-1]; last.punct("*") && (len(expr) == 1 || len(expr) >= 3 && expr[len(expr)-2].punct(".")) {
+		item := selectItem{star: true, source: ColumnSource{Direct: true}}
+		if len(expr) == 1 {
+			item.starTables = tables
+		} else {
+			q := joinName(expr[:len(expr)-2])
+			item.starTables = lookupTables(tables, q)
+		}
+		return item
+	}
+	// 别名
+	var alias string
+	switch n := len(expr); {
+	case n >= 3 && expr[n-2].is("AS") && expr[n-1].isName() || n >= 3 && expr[n-2].is("AS") && expr[n-1].kind == tokString:
+		alias = strings.Trim(expr[n-1].val, "'")
+		expr = expr[:n-2]
+	case n >= 2 && expr[n-1].isName() && canPrecedeAlias(expr[n-2]):
+		alias = expr[n-1].val
+		expr = expr[:n-1]
+	}
+	// 直接引用的列：col、t.col、schema.t.col
+	if name, next := qualifiedName(expr, 0); next == len(expr) && name != "" {
+		q, col := splitQualified(name)
+		if alias == "" {
+			alias = col
+		}
+		// 与表别名同名时可能是整行的引用
+		if ts := rowTables(tables, d, q, col); len(ts) != 0 {
+			refs := append(resolveRef(tables, q, col), wholeRows(ts)...)
+			return selectItem{name: alias, source: ColumnSource{Refs: refs}}
+		}
+		return selectItem{name: alias, source: ColumnSource{Refs: resolveRef(tables, q, col), Direct: true}}
+	}
+	// 计算列，收集表达式中引用到的所有列
+	var refs []ColumnRef
+	for i := 0; i < len(expr); {
+		t := expr[i]
+		switch {
+		case t.punct("(") && i+1 < len(expr) && expr[i+1].is("SELECT", "WITH"):
+			end := matchParen(expr, i)
+			if items, ok := parseQuery(expr[i+1:end], d, ctes); ok {
+				// EXISTS 子查询的输出列不会出现在结果中
+				exists := i > 0 && expr[i-1].is("EXISTS")
+				for _, item := range items {
+					refs = append(refs, item.source.Refs...)
+					if !exists {
+						refs = append(refs, wholeRows(item.starTables)...)
+					}
+				}
+			}
+			i = end + 1
+		case t.isName():
+			name, next := qualifiedName(expr, i)
+			i = next
+			// 函数名
+			if i < len(expr) && expr[i].punct("(") {
+				continue
+			}
+			// 表达式中的 t.* 引用整行
+			if i+1 < len(expr) && expr[i].punct(".") && expr[i+1].punct("*") {
+				i += 2
+				if ts := lookupTables(tables, name); len(ts) != 0 {
+					refs = append(refs, wholeRows(ts)...)
+				} else {
+					refs = append(refs, ColumnRef{Table: name, Column: allColumns})
+				}
+				continue
+			}
+			q, col := splitQualified(name)
+			refs = append(refs, resolveRef(tables, q, col)...)
+			refs = append(refs, wholeRows(rowTables(tables, d, q, col))...)
+		default:
+			i++
+		}
+	}
+	return selectItem{name: alias, source: ColumnSource{Refs: refs}}
+}
+
+// expandItems 将输出项与结果集的列对应起来，星号项按结果列名展开
+func expandItems(items []selectItem, cols []string) []ColumnSource {
+	first, last := -1, -1
+	for i, item := range items {
+		if item.star {
+			if first == -1 {
+				first = i
+			}
+			last = i
+		}
+	}
+	sources := make([]ColumnSource, len(cols))
+	if first == -1 {
+		if len(items) != len(cols) {
+			return nil
+		}
+		for i, item := range items {
+			sources[i] = item.source
+		}
+		return sources
+	}
+	// 星号之前的项对应开头的列，最后一个星号之后的项对应末尾的列
+	trailing := len(items) - last - 1
+	if first+trailing > len(cols) {
+		return nil
+	}
+	for i := 0; i < first; i++ {
+		sources[i] = items[i].source
+	}
+	for i := 0; i < trailing; i++ {
+		sources[len(cols)-trailing+i] = items[last+1+i].source
+	}
+	// 中间的列由星号展开，按列名在星号的来源表中查找
+	var starTables []tableRef
+	for _, item := range items[first : last+1] {
+		starTables = append(starTables, item.starTables...)
+	}
+	for i := first; i < len(cols)-trailing; i++ {
+		sources[i] = ColumnSource{Refs: resolveIn(starTables, cols[i]), Direct: true}
+	}
+	return sources
+}
+
+// rowTables 返回不带限定名的 name 作为整行引用时对应的表，方言不支持整行引用时返回 nil
+func rowTables(tables []tableRef, d Dialect, q, name string) []tableRef {
+	if !d.RowReferences || q != "" {
+		return nil
+	}
+	return lookupTables(tables, name)
+}
+
+// wholeRows 返回引用表的整行时依赖的来源列
+func wholeRows(tables []tableRef) []ColumnRef {
+	var refs []ColumnRef
+	for _, t := range tables {
+		if !t.isDerived {
+			refs = append(refs, ColumnRef{Table: t.name, Column: allColumns})
+			continue
+		}
+		for _, item := range t.derived {
+			refs = append(refs, item.source.Refs...)
+			refs = append(refs, wholeRows(item.starTables)...)
+		}
+	}
+	return refs
+}
+
+// resolveRef 解析列引用，q 为列名前的限定名（表名或别名），可以为空
+func resolveRef(tables []tableRef, q, col string) []ColumnRef {
+	if q != "" {
+		if ts := lookupTables(tables, q); len(ts) != 0 {
+			return resolveIn(ts, col)
+		}
+		return []ColumnRef{{Table: q, Column: col}}
+	}
+	return resolveIn(tables, col)
+}
+
+// resolveIn 在给定的表中查找列，无法确定来自哪个表时返回所有可能的来源
+func resolveIn(tables []tableRef, col string) []ColumnRef {
+	var refs []ColumnRef
+	var base []tableRef
+	for _, t := range tables {
+		if !t.isDerived {
+			base = append(base, t)
+			continue
+		}
+		for _, item := range t.derived {
+			if strings.EqualFold(item.name, col) {
+				refs = append(refs, item.source.Refs...)
+			} else if item.star {
+				refs = append(refs, resolveIn(item.starTables, col)...)
+			}
+		}
+	}
+	switch {
+	case len(base) == 0 && len(refs) == 0:
+		refs = append(refs, ColumnRef{Column: col})
+	case len(base) == 1:
+		refs = append(refs, ColumnRef{Table: base[0].name, Column: col})
+	default:
+		for _, t := range base {
+			refs = append(refs, ColumnRef{Table: t.name, Column: col})
+		}
+	}
+	return refs
+}
+
+// lookupTables 按别名或表名查找表
+func lookupTables(tables []tableRef, q string) []tableRef {
+	var res []tableRef
+	for _, t := range tables {
+		if strings.EqualFold(t.alias, q) || strings.EqualFold(t.name, q) {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// qualifiedName 读取从 i 开始的 a.b.c 形式的名称，返回名称和下一个 token 的位置
+func qualifiedName(toks []token, i int) (string, int) {
+	if i >= len(toks) || !toks[i].isName() {
+		return "", i
+	}
+	parts := []string{toks[i].val}
+	i++
+	for i+1 < len(toks) && toks[i].punct(".") && (toks[i+1].kind == tokWord || toks[i+1].kind == tokIdent) {
+		parts = append(parts, toks[i+1].val)
+		i += 2
+	}
+	return strings.Join(parts, "."), i
+}
+
+// joinName 将 a . b 形式的 token 拼成名称
+func joinName(toks []token) string {
+	var b strings.Builder
+	for _, t := range toks {
+		b.WriteString(t.val)
+	}
+	return b.String()
+}
+
+// splitQualified 拆分限定名为前缀和最后一段
+func splitQualified(name string) (string, string) {
+	if i := strings.LastIndex(name, "."); i != -1 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+// lastPart 返回限定名的最后一段
+func lastPart(name string) string {
+	_, s := splitQualified(name)
+	return s
+}
+
+// canPrecedeAlias 判断省略 AS 的别名前面的 token 是否可以结束一个表达式
+func canPrecedeAlias(t token) bool {
+	switch t.kind {
+	case tokIdent, tokString, tokNumber:
+		return true
+	case tokWord:
+		return t.isName()
+	}
+	return t.punct(")")
+}
+
+// matchParen 返回与 i 处左括号匹配的右括号位置
+func matchParen(toks []token, i int) int {
+	depth := 0
+	for j := i; j < len(toks); j++ {
+		switch {
+		case toks[j].punct("("):
+			depth++
+		case toks[j].punct(")"):
+			if depth--; depth == 0 {
+				return j
+			}
+		}
+	}
+	return len(toks) - 1
+}
+
+// trimParens 去掉包裹整个查询的括号和末尾的分号
+func trimParens(toks []token) []token {
+	for len(toks) > 0 && toks[len(toks)-1].punct(";") {
+		toks = toks[:len(toks)-1]
+	}
+	for len(toks) >= 2 && toks[0].punct("(") && matchParen(toks, 0) == len(toks)-1 {
+		toks = toks[1 : len(toks)-1]
+	}
+	return toks
+}
+
+// indexTop 返回第一个不在括号内的关键字的位置，找不到时返回 len(toks)
+func indexTop(toks []token, words ...string) int {
+	for i := 0; i < len(toks); i++ {
+		switch {
+		case toks[i].punct("("):
+			i = matchParen(toks, i)
+		case toks[i].is(words...):
+			return i
+		}
+	}
+	return len(toks)
+}
+
+// splitTop 按不在括号内的关键字拆分
+func splitTop(toks []token, words ...string) [][]token {
+	var res [][]token
+	for {
+		i := indexTop(toks, words...)
+		res = append(res, toks[:i])
+		if i == len(toks) {
+			return res
+		}
+		toks = toks[i+1:]
+	}
+}
+
+// splitStatements 按不在括号内的分号拆分多条语句
+func splitStatements(toks []token) [][]token {
+	var res [][]token
+	start := 0
+	for i := 0; i < len(toks); i++ {
+		switch {
+		case toks[i].punct("("):
+			i = matchParen(toks, i)
+		case toks[i].punct(";"):
+			if i > start {
+				res = append(res, toks[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(toks) {
+		res = append(res, toks[start:])
+	}
+	return res
+}
+
+// splitComma 按不在括号内的逗号拆分
+func splitComma(toks []token) [][]token {
+	var res [][]token
+	start := 0
+	for i := 0; i < len(toks); i++ {
+		switch {
+		case toks[i].punct("("):
+			i = matchParen(toks, i)
+		case toks[i].punct(","):
+			res = append(res, toks[start:i])
+			start = i + 1
+		}
+	}
+	return append(res, toks[start:])
+}
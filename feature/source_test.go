@@ -0,0 +1,117 @@
+package feature
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jumpserver-dev/usql/text"
+)
+
+func TestPlanMasksHiddenSources(t *testing.T) {
+	rs, err := NewRuleSet([]DataMaskingRule{
+		{Name: "phone", FieldsPattern: "phone", TablePattern: "customers", MaskingMethod: MaskingMethodPhone},
+		{Name: "user phone", FieldsPattern: "phone", TablePattern: "users", MaskingMethod: MaskingMethodPhone},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		driver string
+		sqlstr string
+		cols   []string
+	}{
+		{"mysql", "SELECT /*! phone AS p */ FROM customers", []string{"p"}},
+		{"mysql", "SELECT /*!50100 phone AS p */ FROM customers", []string{"p"}},
+		{"mysql", "SELECT id /*!, phone AS p */ FROM customers", []string{"id", "p"}},
+		{"postgres", "(SELECT phone AS p FROM customers) LIMIT 1", []string{"p"}},
+		{"postgres", "(SELECT phone AS p FROM customers) UNION (SELECT name FROM customers) ORDER BY 1", []string{"p"}},
+		{"postgres", "SELECT c AS j FROM customers c", []string{"j"}},
+		{"postgres", "SELECT to_json(c.*) AS j FROM customers c", []string{"j"}},
+		{"postgres", "SELECT row_to_json(c) AS j FROM customers AS c", []string{"j"}},
+		{"postgres", "SELECT to_json(s) FROM (SELECT phone FROM customers) s", []string{"to_json"}},
+		{"postgres", "SELECT p FROM customers AS c(p)", []string{"p"}},
+		{"postgres", "SELECT * FROM customers AS c(p)", []string{"p", "phone"}},
+		{"postgres", "CALL get_customers()", []string{"p"}},
+		{"postgres", "INSERT INTO log SELECT 1 RETURNING (SELECT phone FROM customers LIMIT 1)", []string{"p"}},
+		{"mysql", `SELECT "\" ", phone AS p FROM users /* ", 1 AS x -- */`, []string{`\" `, "p"}},
+		{"mysql", `SELECT 'it\'s', phone AS p FROM users -- '`, []string{"it's", "p"}},
+		{"postgres", "SELECT $$'$$ AS a, phone AS p FROM users -- ', 1 AS b", []string{"a", "p"}},
+		{"postgres", "SELECT $x$'$x$ AS a, phone AS p FROM users -- ', 1 AS b", []string{"a", "p"}},
+		{"postgres", `SELECT E'\'' AS a, phone AS p FROM users -- ', 1 AS b`, []string{"a", "p"}},
+		{"mysql", "SELECT phone INTO @p FROM users; SELECT @p", []string{"@p"}},
+		{"mysql", "SELECT @p AS p", []string{"p"}},
+		{"sqlserver", "SELECT @p = phone FROM users; SELECT @p AS p", []string{"p"}},
+	}
+	for _, test := range tests {
+		plan, err := rs.Plan(DialectFor(test.driver), test.sqlstr, 0, test.cols)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.sqlstr, err)
+			continue
+		}
+		if plan.Rule(len(test.cols)-1) == nil {
+			t.Errorf("%s: column %q is not masked", test.sqlstr, test.cols[len(test.cols)-1])
+		}
+	}
+}
+
+func TestPlanKeepsUnrelatedColumns(t *testing.T) {
+	rs, err := NewRuleSet([]DataMaskingRule{
+		{Name: "phone", FieldsPattern: "phone", MaskingMethod: MaskingMethodPhone},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		driver string
+		sqlstr string
+		cols   []string
+	}{
+		{"mysql", "SELECT name /* phone */ FROM customers", []string{"name"}},
+		{"mysql", "SELECT user FROM user", []string{"user"}},
+		{"postgres", "SELECT name FROM customers c WHERE EXISTS (SELECT * FROM orders o WHERE o.cid = c.id)", []string{"name"}},
+		{"postgres", "(SELECT name FROM customers) LIMIT 1", []string{"name"}},
+		{"mysql", "SHOW TABLES", []string{"Tables_in_crm"}},
+		{"postgres", "SELECT $$phone$$ AS a, name FROM customers", []string{"a", "name"}},
+		{"postgres", "SELECT name FROM customers WHERE id = $1", []string{"name"}},
+		{"postgres", "SELECT E'phone' AS a, name FROM customers", []string{"a", "name"}},
+		{"mysql", "SELECT @@version, name FROM customers", []string{"@@version", "name"}},
+	}
+	for _, test := range tests {
+		plan, err := rs.Plan(DialectFor(test.driver), test.sqlstr, 0, test.cols)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.sqlstr, err)
+			continue
+		}
+		for i, col := range test.cols {
+			if rule := plan.Rule(i); rule != nil {
+				t.Errorf("%s: column %q is masked by rule %q", test.sqlstr, col, rule.Name)
+			}
+		}
+	}
+}
+
+func TestPlanUnresolvedPolicy(t *testing.T) {
+	rs, err := NewRuleSet([]DataMaskingRule{
+		{Name: "phone", FieldsPattern: "phone", MaskingMethod: MaskingMethodPhone, UnresolvedPolicy: UnresolvedPolicyBlock},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := DialectFor("postgres")
+	if _, err := rs.Plan(d, "CALL get_customers()", 0, []string{"p"}); err == nil {
+		t.Error("expected unresolved column to be blocked")
+	}
+	// 按列名直接匹配的列仍按规则脱敏
+	plan, err := rs.Plan(d, "CALL get_customers()", 0, []string{"phone"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plan.Rule(0) == nil {
+		t.Error("expected column phone to be masked")
+	}
+	if _, err := NewRuleSet([]DataMaskingRule{
+		{Name: "x", FieldsPattern: "x", MaskingMethod: MaskingMethodPhone, UnresolvedPolicy: "ignore"},
+	}); !errors.Is(err, text.ErrInvalidMaskingParam) {
+		t.Errorf("expected invalid unresolved_policy to be rejected, got: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package feature
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaskedColumn 被脱敏规则处理的结果列
+type MaskedColumn struct {
+	// Set 结果集的序号
+	Set    int    `json:"set"`
+	Column string `json:"column"`
+	Rule   string `json:"rule"`
+	Method string `json:"method"`
+}
+
+// MaskingSummary 一次查询的脱敏情况，用于结果的脚注、JSON 输出和审计
+type MaskingSummary struct {
+	Columns    []MaskedColumn `json:"columns,omitempty"`
+	Detections []Detection    `json:"detections,omitempty"`
+}
+
+// Empty 判断查询结果是否没有被脱敏
+func (s MaskingSummary) Empty() bool {
+	return len(s.Columns) == 0 && len(s.Detections) == 0
+}
+
+// Merge 合并另一个查询的脱敏情况
+func (s *MaskingSummary) Merge(o MaskingSummary) {
+	s.Columns = append(s.Columns, o.Columns...)
+	s.Detections = append(s.Detections, o.Detections...)
+}
+
+// Footer 返回显示在表格下方的脱敏说明，例如
+// (masked: phone by "phone-rule", email by "email-rule"; detected: remark 2 phone)
+func (s MaskingSummary) Footer() string {
+	var parts []string
+	if len(s.Columns) != 0 {
+		cols := make([]string, len(s.Columns))
+		for i, c := range s.Columns {
+			cols[i] = c.Column + " by " + strconv.Quote(c.Rule)
+		}
+		parts = append(parts, "masked: "+strings.Join(cols, ", "))
+	}
+	if len(s.Detections) != 0 {
+		ds := make([]string, len(s.Detections))
+		for i, d := range s.Detections {
+			ds[i] = fmt.Sprintf("%s %d %s", d.Column, d.Count, d.Kind)
+		}
+		parts = append(parts, "detected: "+strings.Join(ds, ", "))
+	}
+	return "(" + strings.Join(parts, "; ") + ")"
+}
+
+// Masked 返回使用了脱敏规则的列
+func (p *MaskPlan) Masked(set int, cols []string) []MaskedColumn {
+	if p == nil {
+		return nil
+	}
+	var masked []MaskedColumn
+	for i, rule := range p.rules {
+		if rule == nil || i >= len(cols) {
+			continue
+		}
+		masked = append(masked, MaskedColumn{
+			Set:    set,
+			Column: cols[i],
+			Rule:   rule.Name,
+			Method: rule.MaskingMethod,
+		})
+	}
+	return masked
+}
@@ -0,0 +1,98 @@
+package feature
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"unicode"
+
+	"github.com/jumpserver-dev/usql/store"
+)
+
+// DataMaskingTokenKey 令牌化密钥在全局存储和 DSN 中使用的键，
+// 密钥由启动方传入，不会展示给用户
+const DataMaskingTokenKey = "data-masking-token-key"
+
+// defaultTokenLength hash 方法默认输出的十六进制字符数
+const defaultTokenLength = 16
+
+// NewTokenKey 生成随机的会话密钥，启动方未传入密钥时使用
+func NewTokenKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// tokenKey 返回当前会话的令牌化密钥
+func tokenKey() []byte {
+	if v, ok := store.GetGlobalStore().Get(DataMaskingTokenKey); ok {
+		if key, ok := v.([]byte); ok {
+			return key
+		}
+	}
+	return nil
+}
+
+// hash 返回值的 HMAC-SHA256 十六进制摘要（截断到 TokenLength）
+func (r DataMaskingRule) hash(val string) string {
+	key := tokenKey()
+	if key == nil {
+		// 没有密钥时无法生成稳定的令牌，整体遮盖
+		return r.Params.fullMask(len(graphemes(val)))
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(val))
+	s := hex.EncodeToString(mac.Sum(nil))
+	if n := r.Params.TokenLength; n > 0 && n <= len(s) {
+		return s[:n]
+	}
+	return s[:defaultTokenLength]
+}
+
+// tokenize 生成保留格式的令牌：数字替换为数字、字母替换为同大小写的字母，
+// 空白和标点保持不变，结果长度与原值相同
+func (r DataMaskingRule) tokenize(val string) string {
+	key := tokenKey()
+	if key == nil {
+		return r.Params.fullMask(len(graphemes(val)))
+	}
+	stream := keyStream(key, val)
+	var b strings.Builder
+	var i int
+	for _, c := range val {
+		switch {
+		case unicode.IsDigit(c):
+			b.WriteByte('0' + stream(i)%10)
+		case unicode.IsUpper(c):
+			b.WriteByte('A' + stream(i)%26)
+		case unicode.IsLetter(c):
+			b.WriteByte('a' + stream(i)%26)
+		default:
+			b.WriteRune(c)
+			continue
+		}
+		i++
+	}
+	return b.String()
+}
+
+// keyStream 以 HMAC(key, val) 为种子按需扩展出确定的字节序列
+func keyStream(key []byte, val string) func(int) byte {
+	var blocks [][]byte
+	return func(i int) byte {
+		for len(blocks) <= i/sha256.Size {
+			mac := hmac.New(sha256.New, key)
+			var counter [4]byte
+			binary.BigEndian.PutUint32(counter[:], uint32(len(blocks)))
+			mac.Write(counter[:])
+			mac.Write([]byte(val))
+			blocks = append(blocks, mac.Sum(nil))
+		}
+		return blocks[i/sha256.Size][i%sha256.Size]
+	}
+}
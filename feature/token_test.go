@@ -0,0 +1,94 @@
+package feature
+
+import (
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jumpserver-dev/usql/store"
+)
+
+// withTokenKey 在测试中设置令牌化密钥
+func withTokenKey(t *testing.T, key string) {
+	store.GetGlobalStore().Set(DataMaskingTokenKey, []byte(key))
+	t.Cleanup(func() {
+		store.GetGlobalStore().Delete(DataMaskingTokenKey)
+	})
+}
+
+func TestHash(t *testing.T) {
+	rule := DataMaskingRule{MaskingMethod: MaskingMethodHash}
+	withTokenKey(t, "key one")
+	a, b := rule.Mask("13812345678"), rule.Mask("13812345678")
+	if a != b {
+		t.Errorf("expected the same token for the same value and key, got %q and %q", a, b)
+	}
+	if c := rule.Mask("13812345679"); c == a {
+		t.Errorf("expected different tokens for different values, got %q", c)
+	}
+	withTokenKey(t, "key two")
+	if c := rule.Mask("13812345678"); c == a {
+		t.Errorf("expected different tokens for different keys, got %q", c)
+	}
+	for _, test := range []struct {
+		length int
+		exp    int
+	}{
+		{0, defaultTokenLength},
+		{1, 1},
+		{16, 16},
+		{64, 64},
+	} {
+		rule := DataMaskingRule{MaskingMethod: MaskingMethodHash, Params: MaskingParams{TokenLength: test.length}}
+		if n := len(rule.Mask("13812345678")); n != test.exp {
+			t.Errorf("token_length %d: expected %d characters, got %d", test.length, test.exp, n)
+		}
+	}
+}
+
+func TestHashWithoutKey(t *testing.T) {
+	rule := DataMaskingRule{MaskingMethod: MaskingMethodHash}
+	if res := rule.Mask("张三"); res != "**" {
+		t.Errorf("expected value to be fully masked without a key, got %q", res)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	rule := DataMaskingRule{MaskingMethod: MaskingMethodTokenize}
+	withTokenKey(t, "key one")
+	for _, val := range []string{
+		"13812345678",
+		"6222-0212-3456-7890",
+		"Alice.Smith@example.com",
+		"ID: AB123456",
+		"张三 138",
+		"",
+	} {
+		res := rule.Mask(val)
+		if res != rule.Mask(val) {
+			t.Errorf("%q: expected the same token for the same value and key", val)
+		}
+		if val != "" && res == val {
+			t.Errorf("%q: expected value to be tokenized", val)
+		}
+		if utf8.RuneCountInString(res) != utf8.RuneCountInString(val) {
+			t.Errorf("%q: expected %d characters, got %q", val, utf8.RuneCountInString(val), res)
+			continue
+		}
+		exp, got := []rune(val), []rune(res)
+		for i := range exp {
+			switch c, r := exp[i], got[i]; {
+			case unicode.IsDigit(c) && !unicode.IsDigit(r),
+				unicode.IsUpper(c) && !unicode.IsUpper(r),
+				unicode.IsLower(c) && !unicode.IsLower(r),
+				!unicode.IsLetter(c) && !unicode.IsDigit(c) && c != r:
+				t.Errorf("%q: format not kept at %d, got %q", val, i, res)
+			}
+		}
+	}
+	a := rule.Mask("13812345678")
+	withTokenKey(t, "key two")
+	if b := rule.Mask("13812345678"); a == b {
+		t.Errorf("expected different tokens for different keys, got %q", b)
+	}
+}
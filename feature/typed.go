@@ -0,0 +1,227 @@
+package feature
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnKind 列的数据类别，非文本列使用对应类型的脱敏策略以保持类型不变
+type ColumnKind int
+
+const (
+	KindText ColumnKind = iota
+	KindNumeric
+	KindTemporal
+	KindBinary
+)
+
+// 数值列的脱敏策略
+const (
+	NumericStrategyZero   = "zero"
+	NumericStrategyRound  = "round"
+	NumericStrategyBucket = "bucket"
+)
+
+// 日期时间列的截断精度
+const (
+	DatePrecisionYear  = "year"
+	DatePrecisionMonth = "month"
+	DatePrecisionDay   = "day"
+)
+
+const defaultNumericStep = 100
+
+// dateLayouts 驱动以文本返回日期时间时尝试的格式
+var dateLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02",
+}
+
+// ColumnKindOf 根据驱动返回的列类型判断列的数据类别
+func ColumnKindOf(ct *sql.ColumnType) ColumnKind {
+	if ct == nil {
+		return KindText
+	}
+	name := strings.ToUpper(strings.TrimSpace(ct.DatabaseTypeName()))
+	name = strings.TrimPrefix(name, "UNSIGNED ")
+	if i := strings.IndexAny(name, "( "); i != -1 && !strings.HasPrefix(name, "LONG RAW") {
+		name = name[:i]
+	}
+	switch {
+	case name == "":
+		return KindText
+	case strings.HasPrefix(name, "INTERVAL"):
+		return KindText
+	case hasAnyPrefix(name, "INT", "UINT", "TINYINT", "SMALLINT", "MEDIUMINT", "BIGINT",
+		"DECIMAL", "NUMERIC", "NUMBER", "FLOAT", "DOUBLE", "REAL", "MONEY", "SMALLMONEY",
+		"BINARY_FLOAT", "BINARY_DOUBLE"):
+		return KindNumeric
+	case hasAnyPrefix(name, "DATE", "TIME", "SMALLDATETIME"):
+		return KindTemporal
+	case strings.Contains(name, "BLOB"),
+		hasAnyPrefix(name, "BINARY", "VARBINARY", "BYTEA", "RAW", "LONG RAW", "IMAGE", "BFILE"):
+		return KindBinary
+	}
+	return KindText
+}
+
+// MaskValue 按列的数据类别脱敏。规则设置了 NumericStrategy 或 DatePrecision，
+// 或脱敏方法不保留原值的任何部分（fixed_char 和未知方法）时，数值和日期时间列按类型处理，
+// 尽量保持原有的 Go 类型；其他方法以及无法按类型处理时，对格式化后的值按文本脱敏
+func (r DataMaskingRule) MaskValue(kind ColumnKind, v interface{}) interface{} {
+	switch {
+	case kind == KindNumeric && r.typed(r.Params.NumericStrategy):
+		if res, ok := r.maskNumeric(v); ok {
+			return res
+		}
+	case kind == KindTemporal && r.typed(r.Params.DatePrecision):
+		if res, ok := r.maskTemporal(v); ok {
+			return res
+		}
+	case kind == KindBinary:
+		switch x := v.(type) {
+		case []byte:
+			return fmt.Sprintf("(%d bytes)", len(x))
+		case string:
+			return fmt.Sprintf("(%d bytes)", len(x))
+		}
+	}
+	return r.maskText(v)
+}
+
+// typed 判断是否按列的类型脱敏，strategy 为规则中对应类型的策略
+func (r DataMaskingRule) typed(strategy string) bool {
+	if strategy != "" {
+		return true
+	}
+	switch r.MaskingMethod {
+	case MaskingMethodHideMiddle, MaskingMethodKeepPrefix, MaskingMethodKeepSuffix,
+		MaskingMethodEmail, MaskingMethodPhone, MaskingMethodIDCard, MaskingMethodBankCard,
+		MaskingMethodIP, MaskingMethodRegex, MaskingMethodHash, MaskingMethodTokenize:
+		return false
+	}
+	return true
+}
+
+// maskText 对文本值脱敏
+func (r DataMaskingRule) maskText(v interface{}) interface{} {
+	switch x := v.(type) {
+	case []byte:
+		return r.Mask(string(x))
+	case string:
+		return r.Mask(x)
+	case *string:
+		return r.Mask(*x)
+	case *sql.NullString:
+		if x.Valid {
+			return r.Mask(x.String)
+		}
+		return r.MaskPattern
+	case fmt.Stringer:
+		return r.Mask(x.String())
+	}
+	return r.Mask(fmt.Sprint(v))
+}
+
+// maskNumeric 按 NumericStrategy 处理数值，返回值与原值类型相同
+func (r DataMaskingRule) maskNumeric(v interface{}) (interface{}, bool) {
+	var f float64
+	switch x := v.(type) {
+	case int64:
+		f = float64(x)
+	case int32:
+		f = float64(x)
+	case int:
+		f = float64(x)
+	case uint64:
+		f = float64(x)
+	case float64:
+		f = x
+	case float32:
+		f = float64(x)
+	case []byte:
+		var err error
+		if f, err = strconv.ParseFloat(string(x), 64); err != nil {
+			return nil, false
+		}
+	case string:
+		var err error
+		if f, err = strconv.ParseFloat(x, 64); err != nil {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	step := r.Params.NumericStep
+	if step <= 0 {
+		step = defaultNumericStep
+	}
+	switch r.Params.NumericStrategy {
+	case NumericStrategyRound:
+		f = math.Round(f/step) * step
+	case NumericStrategyBucket:
+		f = math.Floor(f/step) * step
+	default:
+		f = 0
+	}
+	switch v.(type) {
+	case int64:
+		return int64(f), true
+	case int32:
+		return int32(f), true
+	case int:
+		return int(f), true
+	case uint64:
+		return uint64(f), true
+	case float32:
+		return float32(f), true
+	case float64:
+		return f, true
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64), true
+}
+
+// maskTemporal 按 DatePrecision 截断日期时间
+func (r DataMaskingRule) maskTemporal(v interface{}) (interface{}, bool) {
+	switch x := v.(type) {
+	case time.Time:
+		return r.truncateTime(x), true
+	case []byte:
+		return r.maskTemporal(string(x))
+	case string:
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, x); err == nil {
+				return r.truncateTime(t).Format(layout), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// truncateTime 将时间截断到年、月或日
+func (r DataMaskingRule) truncateTime(t time.Time) time.Time {
+	y, m, d := t.Date()
+	switch r.Params.DatePrecision {
+	case DatePrecisionMonth:
+		d = 1
+	case DatePrecisionDay:
+	default:
+		m, d = time.January, 1
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// hasAnyPrefix 判断 s 是否以任意一个前缀开头
+func hasAnyPrefix(s string, prefixes ...string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package feature
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaskValue(t *testing.T) {
+	date := time.Date(2024, time.May, 17, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		rule DataMaskingRule
+		kind ColumnKind
+		v    interface{}
+		exp  interface{}
+	}{
+		{"fixed char numeric", DataMaskingRule{MaskingMethod: MaskingMethodFixedChar, MaskPattern: "***"}, KindNumeric, int64(42), int64(0)},
+		{"unknown method numeric", DataMaskingRule{MaskingMethod: "custom"}, KindNumeric, 3.5, 0.0},
+		{"round numeric", DataMaskingRule{MaskingMethod: MaskingMethodHash, Params: MaskingParams{NumericStrategy: NumericStrategyRound}}, KindNumeric, int64(1234), int64(1200)},
+		{"bucket numeric text", DataMaskingRule{MaskingMethod: MaskingMethodPhone, Params: MaskingParams{NumericStrategy: NumericStrategyBucket, NumericStep: 10}}, KindNumeric, []byte("57.5"), "50"},
+		{"phone numeric", DataMaskingRule{MaskingMethod: MaskingMethodPhone}, KindNumeric, int64(13812345678), "138****5678"},
+		{"keep suffix numeric", DataMaskingRule{MaskingMethod: MaskingMethodKeepSuffix}, KindNumeric, []byte("98765"), "***65"},
+		{"fixed char temporal", DataMaskingRule{MaskingMethod: MaskingMethodFixedChar, MaskPattern: "***"}, KindTemporal, date, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"month temporal", DataMaskingRule{MaskingMethod: MaskingMethodKeepPrefix, Params: MaskingParams{DatePrecision: DatePrecisionMonth}}, KindTemporal, "2024-05-17", "2024-05-01"},
+		{"keep prefix temporal", DataMaskingRule{MaskingMethod: MaskingMethodKeepPrefix, Params: MaskingParams{PrefixLength: intPtr(4)}}, KindTemporal, "2024-05-17", "2024******"},
+		{"binary", DataMaskingRule{MaskingMethod: MaskingMethodHash}, KindBinary, []byte{1, 2, 3}, "(3 bytes)"},
+	}
+	for _, test := range tests {
+		if res := test.rule.MaskValue(test.kind, test.v); res != test.exp {
+			t.Errorf("%s: expected %#v, got %#v", test.name, test.exp, res)
+		}
+	}
+	// hash 和 tokenize 对数值按文本处理，不会得到 0
+	rule := DataMaskingRule{MaskingMethod: MaskingMethodHash}
+	if res, ok := rule.MaskValue(KindNumeric, int64(42)).(string); !ok || res == "" || res == "0" {
+		t.Errorf("hash numeric: expected a token, got %#v", res)
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -0,0 +1,172 @@
+package feature
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jumpserver-dev/usql/text"
+)
+
+// maxTokenLength hash 方法输出的最大长度，即 HMAC-SHA256 的十六进制长度
+const maxTokenLength = 64
+
+// RuleError 一条脱敏规则的校验错误
+type RuleError struct {
+	// Index 规则在配置中的下标
+	Index int
+	// Name 规则名称
+	Name string
+	// Field 出错的字段，使用 JSON 中的名称
+	Field string
+	// Err 错误原因，可以用 errors.Is 与 text 包中的错误比较
+	Err error
+}
+
+// Error satisfies the error interface.
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("masking rule #%d %q: %s: %v", e.Index, e.Name, e.Field, e.Err)
+}
+
+// Unwrap returns the original error.
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError 脱敏规则集合的校验错误，包含所有规则的错误
+type ValidationError struct {
+	Errors []*RuleError
+}
+
+// Error satisfies the error interface.
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		lines[i] = err.Error()
+	}
+	return "invalid data masking rules:\n  " + strings.Join(lines, "\n  ")
+}
+
+// Unwrap returns the rule errors.
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// ValidateRules 校验脱敏规则，检查未知的脱敏方法、无效的参数和空的匹配模式，
+// 有错误时返回 *ValidationError
+func ValidateRules(rules []DataMaskingRule) error {
+	var errs []*RuleError
+	for i := range rules {
+		errs = append(errs, rules[i].validate(i)...)
+	}
+	if len(errs) != 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// validate 校验一条规则
+func (r DataMaskingRule) validate(index int) []*RuleError {
+	var errs []*RuleError
+	add := func(field string, err error, format string, v ...interface{}) {
+		if format != "" {
+			err = fmt.Errorf("%w: "+format, append([]interface{}{err}, v...)...)
+		}
+		errs = append(errs, &RuleError{Index: index, Name: r.Name, Field: field, Err: err})
+	}
+
+	// 匹配模式，fields_pattern 必填，其余为空时不限制
+	for _, p := range []struct {
+		field    string
+		value    string
+		required bool
+	}{
+		{"fields_pattern", r.FieldsPattern, true},
+		{"database_pattern", r.DatabasePattern, false},
+		{"schema_pattern", r.SchemaPattern, false},
+		{"table_pattern", r.TablePattern, false},
+	} {
+		switch {
+		case strings.TrimSpace(p.value) == "":
+			if p.required {
+				add(p.field, text.ErrEmptyMaskingPattern, "")
+			}
+		case hasEmptyPattern(p.value):
+			add(p.field, text.ErrInvalidMaskingPattern, "%q contains an empty pattern", p.value)
+		}
+	}
+
+	// 脱敏方法及其参数
+	switch r.MaskingMethod {
+	case MaskingMethodFixedChar:
+		if r.MaskPattern == "" {
+			add("mask_pattern", text.ErrInvalidMaskingParam, "required by %s", r.MaskingMethod)
+		}
+	case MaskingMethodRegex:
+		if r.MaskPattern == "" {
+			add("mask_pattern", text.ErrInvalidMaskingParam, "required by %s", r.MaskingMethod)
+		} else if _, err := compileMaskPattern(r.MaskPattern); err != nil {
+			add("mask_pattern", text.ErrInvalidMaskingPattern, "%q: %v", r.MaskPattern, err)
+		}
+	case MaskingMethodHideMiddle, MaskingMethodKeepPrefix, MaskingMethodKeepSuffix,
+		MaskingMethodEmail, MaskingMethodPhone, MaskingMethodIDCard, MaskingMethodBankCard,
+		MaskingMethodIP, MaskingMethodHash, MaskingMethodTokenize:
+	default:
+		add("masking_method", text.ErrUnknownMaskingMethod, "%q", r.MaskingMethod)
+	}
+
+	p := r.Params
+	if p.PrefixLength != nil && *p.PrefixLength < 0 {
+		add("params.prefix_length", text.ErrInvalidMaskingParam, "%d is negative", *p.PrefixLength)
+	}
+	if p.SuffixLength != nil && *p.SuffixLength < 0 {
+		add("params.suffix_length", text.ErrInvalidMaskingParam, "%d is negative", *p.SuffixLength)
+	}
+	if p.MaskChar != "" && len(graphemes(p.MaskChar)) != 1 {
+		add("params.mask_char", text.ErrInvalidMaskingParam, "%q is not a single character", p.MaskChar)
+	}
+	if p.MinVisibleLength < 0 {
+		add("params.min_visible_length", text.ErrInvalidMaskingParam, "%d is negative", p.MinVisibleLength)
+	}
+	if p.TokenLength < 0 || p.TokenLength > maxTokenLength {
+		add("params.token_length", text.ErrInvalidMaskingParam, "%d is not between 1 and %d", p.TokenLength, maxTokenLength)
+	}
+	switch p.NumericStrategy {
+	case "", NumericStrategyZero, NumericStrategyRound, NumericStrategyBucket:
+	default:
+		add("params.numeric_strategy", text.ErrInvalidMaskingParam, "unknown strategy %q", p.NumericStrategy)
+	}
+	if p.NumericStep < 0 || math.IsNaN(p.NumericStep) || math.IsInf(p.NumericStep, 0) {
+		add("params.numeric_step", text.ErrInvalidMaskingParam, "%v is not a positive number", p.NumericStep)
+	}
+	switch p.DatePrecision {
+	case "", DatePrecisionYear, DatePrecisionMonth, DatePrecisionDay:
+	default:
+		add("params.date_precision", text.ErrInvalidMaskingParam, "unknown precision %q", p.DatePrecision)
+	}
+	switch r.ComputedPolicy {
+	case "", ComputedPolicyMask, ComputedPolicyBlock, ComputedPolicyAllow:
+	default:
+		add("computed_policy", text.ErrInvalidMaskingParam, "unknown policy %q", r.ComputedPolicy)
+	}
+	switch r.UnresolvedPolicy {
+	case "", UnresolvedPolicyMask, UnresolvedPolicyBlock:
+	default:
+		add("unresolved_policy", text.ErrInvalidMaskingParam, "unknown policy %q", r.UnresolvedPolicy)
+	}
+	return errs
+}
+
+// hasEmptyPattern 判断逗号分隔的模式中是否有空的模式，例如 "a,,b"
+func hasEmptyPattern(s string) bool {
+	for _, p := range strings.Split(s, ",") {
+		if strings.TrimSpace(p) == "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jumpserver-dev/usql/feature"
+	"github.com/jumpserver-dev/usql/store"
+	"github.com/xo/usql/drivers"
+)
+
+// execStats 一次 Execute 的执行情况，用于审计日志
+type execStats struct {
+	// prev 外层语句的执行情况，\gexec 执行的语句结束后恢复
+	prev      *execStats
+	raw       string
+	statement string
+	start     time.Time
+	// rows 查询返回的行数或语句影响的行数
+	rows           int64
+	truncated      bool
+	readOnlyDenied bool
+	filter         *feature.FilterDecision
+	masking        feature.MaskingSummary
+}
+
+// beginStats 开始记录语句的执行情况
+func (h *Handler) beginStats(sqlstr string) *execStats {
+	// 从输入缓冲区执行的语句记录用户输入的原文，\gexec 等执行的语句没有原文
+	raw := sqlstr
+	if sqlstr == h.last {
+		raw = h.lastRaw
+	}
+	h.stats = &execStats{
+		prev:      h.stats,
+		raw:       raw,
+		statement: sqlstr,
+		start:     time.Now(),
+	}
+	return h.stats
+}
+
+// endStats 结束记录语句的执行情况，配置了审计日志时写入一条记录
+func (h *Handler) endStats(stats *execStats, err error) {
+	h.stats = stats.prev
+	v, ok := store.GetGlobalStore().Get(feature.AuditLogKey)
+	if !ok {
+		return
+	}
+	rec := feature.AuditRecord{
+		Driver:         h.u.Driver,
+		Raw:            stats.raw,
+		Statement:      stats.statement,
+		Start:          stats.start,
+		DurationMS:     float64(time.Since(stats.start)) / float64(time.Millisecond),
+		Rows:           stats.rows,
+		Truncated:      stats.truncated,
+		ReadOnlyDenied: stats.readOnlyDenied,
+		Filter:         stats.filter,
+	}
+	if h.u.User != nil {
+		rec.DBUser = h.u.User.Username()
+	}
+	rec.DBHost, rec.Database = h.u.Hostname(), strings.TrimPrefix(h.u.Path, "/")
+	if !stats.masking.Empty() {
+		rec.Masking = &stats.masking
+	}
+	if err != nil {
+		rec.ErrorCode, rec.Error = errorCode(h.u.Driver, err), feature.RedactError(err).Error()
+	}
+	if err := v.(*feature.AuditLog).Write(rec); err != nil {
+		fmt.Fprintln(h.l.Stderr(), "error: audit log:", err)
+	}
+}
+
+// errorCode 返回驱动 Err 给出的错误码，不是数据库返回的错误时为空
+func errorCode(driver string, err error) string {
+	var e *drivers.Error
+	if !errors.As(err, &e) {
+		return ""
+	}
+	if d, ok := drivers.Available()[driver]; ok && d.Err != nil {
+		code, _ := d.Err(e.Err)
+		return code
+	}
+	return ""
+}
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jumpserver-dev/usql/feature"
+	"github.com/jumpserver-dev/usql/metacmd"
+	"github.com/jumpserver-dev/usql/store"
+	"github.com/xo/dburl"
+	"github.com/xo/usql/stmt"
+)
+
+// withAuditLog 在测试中将审计日志写入内存，返回读取已写入记录的函数
+func withAuditLog(t *testing.T) func() []feature.AuditRecord {
+	t.Helper()
+	sink := new(bytes.Buffer)
+	store.GetGlobalStore().Set(feature.AuditLogKey, feature.NewAuditLog(sink, "session-1", "alice"))
+	t.Cleanup(func() {
+		store.GetGlobalStore().Delete(feature.AuditLogKey)
+	})
+	return func() []feature.AuditRecord {
+		var recs []feature.AuditRecord
+		for _, line := range strings.Split(strings.TrimSpace(sink.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var rec feature.AuditRecord
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				t.Fatalf("invalid audit record %q: %v", line, err)
+			}
+			recs = append(recs, rec)
+		}
+		sink.Reset()
+		return recs
+	}
+}
+
+// withCommandFilter 在测试中设置命令过滤规则
+func withCommandFilter(t *testing.T, rules ...feature.CommandFilterRule) {
+	f, err := feature.NewCommandFilter(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.GetGlobalStore().Set(feature.CommandFilterKey, f)
+	t.Cleanup(func() {
+		store.GetGlobalStore().Delete(feature.CommandFilterKey)
+	})
+}
+
+// newAuditHandler 创建连接到 app@db/shop 的 Handler
+func newAuditHandler(t *testing.T) (*Handler, *fakeServer) {
+	h, srv, _ := newFakeHandler(t, map[string]fakeResult{
+		"SELECT name, phone FROM users": {
+			cols: []string{"name", "phone"},
+			rows: [][]driver.Value{{"alice", secretPhone}, {"bob", secretPhone}},
+		},
+		"SELECT stmt FROM jobs": {
+			cols: []string{"stmt"},
+			rows: [][]driver.Value{{"UPDATE a SET x = 1"}, {"DROP TABLE b"}, {"UPDATE c SET x = 1"}},
+		},
+	})
+	h.u = &dburl.URL{URL: url.URL{User: url.User("app"), Host: "db:3306", Path: "/shop"}, Driver: "fake"}
+	return h, srv
+}
+
+func TestAuditRecord(t *testing.T) {
+	records := withAuditLog(t)
+	withMaskingRules(t)
+	h, _ := newAuditHandler(t)
+	tests := []struct {
+		sqlstr    string
+		rows      int64
+		errorCode string
+		masking   []string
+	}{
+		{"SELECT name, phone FROM users", 2, "", []string{"phone"}},
+		{"UPDATE users SET name = 'x'", 1, "", nil},
+		{"SELECT * FROM missing", 0, "42P01", nil},
+	}
+	for _, test := range tests {
+		err := h.Execute(context.Background(), new(strings.Builder), metacmd.Option{}, stmt.FindPrefix(test.sqlstr, true, true, true), test.sqlstr, false)
+		if (test.errorCode != "") != (err != nil) {
+			t.Fatalf("%s: unexpected error: %v", test.sqlstr, err)
+		}
+		recs := records()
+		if len(recs) != 1 {
+			t.Fatalf("%s: expected 1 audit record, got %d", test.sqlstr, len(recs))
+		}
+		rec := recs[0]
+		if rec.SessionID != "session-1" || rec.OSUser != "alice" || rec.Driver != "fake" || rec.DBUser != "app" || rec.DBHost != "db" || rec.Database != "shop" {
+			t.Errorf("%s: unexpected connection fields: %+v", test.sqlstr, rec)
+		}
+		if rec.Statement != test.sqlstr || rec.Raw != test.sqlstr || rec.Start.IsZero() {
+			t.Errorf("%s: unexpected statement fields: %+v", test.sqlstr, rec)
+		}
+		if rec.Rows != test.rows {
+			t.Errorf("%s: expected rows %d, got %d", test.sqlstr, test.rows, rec.Rows)
+		}
+		if rec.ErrorCode != test.errorCode || (test.errorCode != "") != (rec.Error != "") {
+			t.Errorf("%s: expected error code %q, got %q (%q)", test.sqlstr, test.errorCode, rec.ErrorCode, rec.Error)
+		}
+		var masked []string
+		if rec.Masking != nil {
+			for _, c := range rec.Masking.Columns {
+				masked = append(masked, c.Column)
+			}
+		}
+		if strings.Join(masked, ",") != strings.Join(test.masking, ",") {
+			t.Errorf("%s: expected masked columns %v, got %v", test.sqlstr, test.masking, masked)
+		}
+		if rec.Filter != nil || rec.ReadOnlyDenied {
+			t.Errorf("%s: expected no filter decision, got %+v, read-only denied %t", test.sqlstr, rec.Filter, rec.ReadOnlyDenied)
+		}
+	}
+}
+
+func TestAuditDenied(t *testing.T) {
+	records := withAuditLog(t)
+	withCommandFilter(t,
+		feature.CommandFilterRule{Name: "no drop", StatementTypes: []string{"DROP"}, Action: feature.CommandActionDeny},
+		feature.CommandFilterRule{Name: "confirm delete", StatementTypes: []string{"DELETE"}, Action: feature.CommandActionConfirm},
+		feature.CommandFilterRule{Name: "users", Pattern: `\busers\b`, Action: feature.CommandActionAllow},
+	)
+	h, srv := newAuditHandler(t)
+	var confirmed bool
+	h.confirm = func(string) (bool, error) {
+		return confirmed, nil
+	}
+	tests := []struct {
+		sqlstr    string
+		confirmed bool
+		exp       *feature.FilterDecision
+	}{
+		{"DROP TABLE users", false, &feature.FilterDecision{Rule: "no drop", Action: feature.CommandActionDeny, Result: feature.FilterResultDenied}},
+		{"DELETE FROM logs", false, &feature.FilterDecision{Rule: "confirm delete", Action: feature.CommandActionConfirm, Result: feature.FilterResultNotConfirmed}},
+		{"DELETE FROM logs", true, &feature.FilterDecision{Rule: "confirm delete", Action: feature.CommandActionConfirm, Result: feature.FilterResultConfirmed}},
+		{"SELECT name, phone FROM users", false, &feature.FilterDecision{Rule: "users", Action: feature.CommandActionAllow, Result: feature.FilterResultAllowed}},
+		{"UPDATE logs SET x = 1", false, nil},
+	}
+	for _, test := range tests {
+		confirmed = test.confirmed
+		n := len(srv.executed())
+		err := h.Execute(context.Background(), new(strings.Builder), metacmd.Option{}, stmt.FindPrefix(test.sqlstr, true, true, true), test.sqlstr, false)
+		denied := test.exp != nil && (test.exp.Result == feature.FilterResultDenied || test.exp.Result == feature.FilterResultNotConfirmed)
+		if denied != (err != nil) {
+			t.Fatalf("%s: unexpected error: %v", test.sqlstr, err)
+		}
+		if executed := len(srv.executed()) != n; executed == denied {
+			t.Errorf("%s: expected executed %t", test.sqlstr, !denied)
+		}
+		recs := records()
+		if len(recs) != 1 {
+			t.Fatalf("%s: expected 1 audit record, got %d", test.sqlstr, len(recs))
+		}
+		switch rec := recs[0]; {
+		case test.exp == nil && rec.Filter != nil,
+			test.exp != nil && (rec.Filter == nil || *rec.Filter != *test.exp):
+			t.Errorf("%s: expected filter decision %+v, got %+v", test.sqlstr, test.exp, rec.Filter)
+		case denied && rec.Error == "":
+			t.Errorf("%s: expected denied statement to record an error", test.sqlstr)
+		}
+	}
+}
+
+func TestAuditReadOnlyDenied(t *testing.T) {
+	records := withAuditLog(t)
+	store.GetGlobalStore().Set(feature.ReadOnlyKey, true)
+	t.Cleanup(func() {
+		store.GetGlobalStore().Delete(feature.ReadOnlyKey)
+	})
+	h, srv := newAuditHandler(t)
+	if err := h.Execute(context.Background(), new(strings.Builder), metacmd.Option{}, "DELETE", "DELETE FROM users", false); err == nil {
+		t.Fatal("expected DELETE to be denied in read-only mode")
+	}
+	if q := srv.executed(); len(q) != 0 {
+		t.Errorf("expected no statements to be executed, got %q", q)
+	}
+	recs := records()
+	if len(recs) != 1 || !recs[0].ReadOnlyDenied || recs[0].Error == "" || recs[0].Statement != "DELETE FROM users" {
+		t.Errorf("expected a read-only denied record for DELETE, got %+v", recs)
+	}
+}
+
+func TestAuditGexec(t *testing.T) {
+	records := withAuditLog(t)
+	withCommandFilter(t, feature.CommandFilterRule{Name: "no drop", StatementTypes: []string{"DROP"}, Action: feature.CommandActionDeny})
+	h, srv := newAuditHandler(t)
+	opt := metacmd.Option{Exec: metacmd.ExecExec}
+	if err := h.Execute(context.Background(), new(strings.Builder), opt, "SELECT", "SELECT stmt FROM jobs", false); err == nil {
+		t.Fatal("expected \\gexec to stop at the denied statement")
+	}
+	if n := srv.count("UPDATE c"); n != 0 {
+		t.Errorf("expected statements after the denied one not to be executed")
+	}
+	// 子语句在外层语句之前结束，先写入审计日志
+	recs := records()
+	exp := []struct {
+		statement string
+		rows      int64
+		filter    bool
+		err       bool
+	}{
+		{"UPDATE a SET x = 1", 1, false, false},
+		{"DROP TABLE b", 0, true, true},
+		{"SELECT stmt FROM jobs", 3, false, true},
+	}
+	if len(recs) != len(exp) {
+		t.Fatalf("expected %d audit records, got %d: %+v", len(exp), len(recs), recs)
+	}
+	for i, e := range exp {
+		rec := recs[i]
+		if rec.Statement != e.statement || rec.Raw != e.statement || rec.Rows != e.rows || (rec.Filter != nil) != e.filter || (rec.Error != "") != e.err {
+			t.Errorf("record %d: expected %+v, got %+v", i, e, rec)
+		}
+	}
+}
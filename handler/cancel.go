@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jumpserver-dev/usql/text"
+	"github.com/xo/usql/env"
+)
+
+// cancelTimeout 在服务端取消语句的超时时间
+const cancelTimeout = 5 * time.Second
+
+// serverCancels 各驱动查询当前连接 ID 和在服务端取消语句的语句。
+// 其他驱动在 context 取消时由驱动自身通知服务端，例如 sqlserver 发送 attention
+var serverCancels = map[string]struct {
+	id     string
+	cancel string
+}{
+	"mysql":    {"SELECT CONNECTION_ID()", "KILL QUERY %d"},
+	"postgres": {"SELECT pg_backend_pid()", "SELECT pg_cancel_backend(%d)"},
+}
+
+// statementContext 返回执行语句使用的 context，中断时被取消。
+// STATEMENT_TIMEOUT 由 withTimeout 对每一次查询分别计时
+func statementContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// timeoutContext 返回超过 STATEMENT_TIMEOUT 时被取消的 ctx
+func timeoutContext(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	timeout, err := statementTimeout()
+	switch {
+	case err != nil:
+		return nil, nil, err
+	case timeout == 0:
+		return ctx, func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
+
+// statementTimeout 返回 STATEMENT_TIMEOUT 变量设置的超时时间，值可以是 30s 这样的时长
+// 或秒数，未设置或为 0 时不限制
+func statementTimeout() (time.Duration, error) {
+	s := env.Get("STATEMENT_TIMEOUT")
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		var n float64
+		if n, err = strconv.ParseFloat(s, 64); err == nil {
+			d = time.Duration(n * float64(time.Second))
+		}
+	}
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf(text.InvalidTimeout, s)
+	}
+	return d, nil
+}
+
+// withTimeout 执行一次查询，超过 STATEMENT_TIMEOUT 或中断时取消 f 中执行的语句，
+// 包括在服务端取消。\watch 每次执行分别计时
+func (h *Handler) withTimeout(ctx context.Context, f func(context.Context) error) error {
+	ctx, cancel, err := timeoutContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	stop := h.watchCancel(ctx)
+	err = f(ctx)
+	stop()
+	if err != nil && h.pinned != nil && h.tx == nil {
+		// 语句被取消时驱动可能关闭了连接，固定的连接不可用时放弃，下一条语句重新固定
+		pctx, pcancel := context.WithTimeout(context.Background(), cancelTimeout)
+		if h.pinned.PingContext(pctx) != nil {
+			h.unpin()
+		}
+		pcancel()
+	}
+	return canceled(ctx, err)
+}
+
+// watchCancel 在 ctx 被取消时通过另一个连接在服务端取消正在执行的语句，例如 MySQL 的驱动
+// 只会断开连接，语句仍会在服务端继续执行。返回的函数在语句执行完后调用
+func (h *Handler) watchCancel(ctx context.Context) func() {
+	sc, ok := serverCancels[h.u.Driver]
+	// 事务没有在固定的连接上开始时，不知道语句在哪个连接上执行
+	if !ok || ctx.Done() == nil || h.tx != nil && h.pinned == nil {
+		return func() {}
+	}
+	p := h.pin(ctx)
+	if p == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			cctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+			defer cancel()
+			if _, err := h.db.ExecContext(cctx, fmt.Sprintf(sc.cancel, p.id)); err != nil {
+				fmt.Fprintln(h.l.Stderr(), "error: unable to cancel statement on server:", err)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// pin 返回会话固定使用的连接，第一次调用时从连接池中取出一个连接并查询其 ID，
+// 之后不在事务中的语句和开始的事务都使用该连接，以便知道语句在哪个连接上执行。
+// 驱动不支持在服务端取消语句或无法取得连接时返回 nil，语句仍使用连接池
+func (h *Handler) pin(ctx context.Context) *pinnedConn {
+	if h.pinned != nil {
+		return h.pinned
+	}
+	sc, ok := serverCancels[h.u.Driver]
+	if !ok {
+		return nil
+	}
+	conn, err := h.db.Conn(ctx)
+	if err != nil {
+		return nil
+	}
+	var id int64
+	if err := conn.QueryRowContext(ctx, sc.id).Scan(&id); err != nil {
+		conn.Close()
+		return nil
+	}
+	h.pinned = &pinnedConn{connDB{conn}, id}
+	return h.pinned
+}
+
+// unpin 将固定的连接放回连接池
+func (h *Handler) unpin() {
+	if h.pinned != nil {
+		h.pinned.Close()
+		h.pinned = nil
+	}
+}
+
+// canceled 将因 ctx 被取消而失败的错误替换为超时或中断的错误，
+// 驱动返回的错误各不相同，例如 MySQL 为 invalid connection
+func canceled(ctx context.Context, err error) error {
+	switch {
+	case err == nil || ctx.Err() == nil:
+		return err
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return text.ErrStatementTimeout
+	}
+	return text.ErrStatementCanceled
+}
+
+// pinnedConn 会话固定使用的连接及其在服务端的 ID
+type pinnedConn struct {
+	connDB
+	id int64
+}
+
+// connDB 将 *sql.Conn 包装为 drivers.DB，使语句在固定的连接上执行
+type connDB struct {
+	*sql.Conn
+}
+
+// Exec satisfies the drivers.DB interface.
+func (c connDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.ExecContext(context.Background(), query, args...)
+}
+
+// Query satisfies the drivers.DB interface.
+func (c connDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.QueryContext(context.Background(), query, args...)
+}
+
+// QueryRow satisfies the drivers.DB interface.
+func (c connDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.QueryRowContext(context.Background(), query, args...)
+}
+
+// Prepare satisfies the drivers.DB interface.
+func (c connDB) Prepare(query string) (*sql.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jumpserver-dev/usql/metacmd"
+	"github.com/jumpserver-dev/usql/text"
+	"github.com/xo/usql/env"
+)
+
+// withServerCancel 在测试中让假驱动支持在服务端取消语句
+func withServerCancel(t *testing.T) {
+	serverCancels["fake"] = serverCancels["mysql"]
+	t.Cleanup(func() {
+		delete(serverCancels, "fake")
+	})
+}
+
+// withStatementTimeout 在测试中设置 STATEMENT_TIMEOUT
+func withStatementTimeout(t *testing.T, timeout string) {
+	if err := env.Set("STATEMENT_TIMEOUT", timeout); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = env.Unset("STATEMENT_TIMEOUT")
+	})
+}
+
+func TestStatementTimeoutCancelsOnServer(t *testing.T) {
+	withServerCancel(t)
+	withStatementTimeout(t, "20ms")
+	h, srv, _ := newFakeHandler(t, nil)
+	err := h.Execute(context.Background(), h.l.Stdout(), metacmd.Option{}, "", "SLEEP 10", false)
+	if !errors.Is(err, text.ErrStatementTimeout) {
+		t.Fatalf("expected %v, got: %v", text.ErrStatementTimeout, err)
+	}
+	if n := srv.count("KILL QUERY"); n != 1 {
+		t.Errorf("expected statement to be canceled on server once, got %d: %q", n, srv.executed())
+	}
+}
+
+func TestConnectionIDLookedUpOnce(t *testing.T) {
+	withServerCancel(t)
+	h, srv, _ := newFakeHandler(t, nil)
+	ctx, stop := statementContext()
+	defer stop()
+	for i := 0; i < 3; i++ {
+		if err := h.Execute(ctx, h.l.Stdout(), metacmd.Option{}, "", fmt.Sprintf("SELECT %d", i), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.BeginTx(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Execute(ctx, h.l.Stdout(), metacmd.Option{}, "", "SELECT 3", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.count("SELECT CONNECTION_ID()"); n != 1 {
+		t.Errorf("expected connection id to be looked up once, got %d", n)
+	}
+	if srv.conns != 1 {
+		t.Errorf("expected all statements on one connection, got %d connections", srv.conns)
+	}
+}
+
+func TestWatchTimesOutEachQuery(t *testing.T) {
+	withStatementTimeout(t, "30ms")
+	h, srv, _ := newFakeHandler(t, map[string]fakeResult{
+		"SELECT 1": {cols: []string{"n"}, rows: [][]driver.Value{{int64(1)}}},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(150*time.Millisecond, cancel)
+	opt := metacmd.Option{Exec: metacmd.ExecWatch, Watch: 10 * time.Millisecond}
+	if err := h.Execute(ctx, h.l.Stdout(), opt, "", "SELECT 1", false); err != nil {
+		t.Fatalf("expected \\watch to run until interrupted, got: %v", err)
+	}
+	if n := srv.count("SELECT 1"); n < 5 {
+		t.Errorf("expected \\watch to keep running after STATEMENT_TIMEOUT, ran %d times", n)
+	}
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"os/user"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/xo/dburl"
+	"github.com/xo/usql/drivers"
+	"github.com/xo/usql/rline"
+)
+
+// fakeResult 假驱动对一条查询返回的结果
+type fakeResult struct {
+	cols []string
+	rows [][]driver.Value
+	// err 读取完 rows 后返回的错误
+	err error
+	// next 之后的结果集
+	next []fakeResult
+}
+
+// fakeServer 假驱动连接的数据库，记录执行过的语句
+type fakeServer struct {
+	mu      sync.Mutex
+	results map[string]fakeResult
+	// queries 执行过的语句，按执行顺序
+	queries []string
+	// conns 打开过的连接数，open 当前打开的连接数
+	conns int
+	open  int
+}
+
+var fakeServers = struct {
+	sync.Mutex
+	m map[string]*fakeServer
+}{m: make(map[string]*fakeServer)}
+
+func init() {
+	sql.Register("fake", fakeDriver{})
+	drivers.Register("fake", drivers.Driver{
+		Err: func(err error) (string, string) {
+			if e, ok := err.(*fakeError); ok {
+				return e.code, e.msg
+			}
+			return "", err.Error()
+		},
+	})
+}
+
+// fakeError 假驱动返回的带错误码的错误
+type fakeError struct {
+	code string
+	msg  string
+}
+
+// Error satisfies the error interface.
+func (e *fakeError) Error() string {
+	return e.code + ": " + e.msg
+}
+
+// newFakeHandler 创建连接到假驱动的 Handler，返回的 out 为标准输出和标准错误
+func newFakeHandler(t *testing.T, results map[string]fakeResult) (*Handler, *fakeServer, *bytes.Buffer) {
+	t.Helper()
+	srv := &fakeServer{results: results}
+	fakeServers.Lock()
+	fakeServers.m[t.Name()] = srv
+	fakeServers.Unlock()
+	db, err := sql.Open("fake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	l := &rline.Rline{
+		N:   func() ([]rune, error) { return nil, io.EOF },
+		Out: out,
+		Err: out,
+	}
+	h := New(l, &user.User{Username: "test"}, t.TempDir(), true)
+	h.db, h.u = db, &dburl.URL{Driver: "fake"}
+	t.Cleanup(func() {
+		h.Close()
+		fakeServers.Lock()
+		delete(fakeServers.m, t.Name())
+		fakeServers.Unlock()
+	})
+	return h, srv, out
+}
+
+// executed 返回执行过的语句
+func (s *fakeServer) executed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+// count 返回以 prefix 开头的语句执行的次数
+func (s *fakeServer) count(prefix string) int {
+	var n int
+	for _, q := range s.executed() {
+		if strings.HasPrefix(q, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+type fakeDriver struct{}
+
+// Open satisfies the driver.Driver interface.
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeServers.Lock()
+	srv := fakeServers.m[name]
+	fakeServers.Unlock()
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.conns++
+	srv.open++
+	return &fakeConn{srv: srv, id: srv.conns}, nil
+}
+
+type fakeConn struct {
+	srv *fakeServer
+	id  int
+}
+
+// Prepare satisfies the driver.Conn interface.
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+// Close satisfies the driver.Conn interface.
+func (c *fakeConn) Close() error {
+	c.srv.mu.Lock()
+	defer c.srv.mu.Unlock()
+	c.srv.open--
+	return nil
+}
+
+// Begin satisfies the driver.Conn interface.
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+// Commit satisfies the driver.Tx interface.
+func (c *fakeConn) Commit() error {
+	return nil
+}
+
+// Rollback satisfies the driver.Tx interface.
+func (c *fakeConn) Rollback() error {
+	return nil
+}
+
+// ExecContext satisfies the driver.ExecerContext interface. SLEEP 开头的语句阻塞到 ctx 被取消
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.record(query)
+	if strings.HasPrefix(query, "SLEEP") {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return driver.RowsAffected(1), nil
+}
+
+// QueryContext satisfies the driver.QueryerContext interface. SELECT CONNECTION_ID() 返回连接的 ID，
+// 查询 missing 表的语句返回错误码为 42P01 的错误
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.record(query)
+	if strings.Contains(query, "FROM missing") {
+		return nil, &fakeError{code: "42P01", msg: "relation does not exist"}
+	}
+	if query == "SELECT CONNECTION_ID()" {
+		return &fakeRows{res: fakeResult{cols: []string{"id"}, rows: [][]driver.Value{{int64(c.id)}}}}, nil
+	}
+	res, ok := c.srv.results[query]
+	if !ok {
+		return &fakeRows{}, nil
+	}
+	return &fakeRows{res: res, next: res.next}, nil
+}
+
+func (c *fakeConn) record(query string) {
+	c.srv.mu.Lock()
+	defer c.srv.mu.Unlock()
+	c.srv.queries = append(c.srv.queries, query)
+}
+
+type fakeRows struct {
+	res  fakeResult
+	i    int
+	next []fakeResult
+}
+
+// Columns satisfies the driver.Rows interface.
+func (r *fakeRows) Columns() []string {
+	return r.res.cols
+}
+
+// Close satisfies the driver.Rows interface.
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+// Next satisfies the driver.Rows interface.
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.res.rows) {
+		if r.res.err != nil {
+			return r.res.err
+		}
+		return io.EOF
+	}
+	copy(dest, r.res.rows[r.i])
+	r.i++
+	return nil
+}
+
+// HasNextResultSet satisfies the driver.RowsNextResultSet interface.
+func (r *fakeRows) HasNextResultSet() bool {
+	return len(r.next) != 0
+}
+
+// NextResultSet satisfies the driver.RowsNextResultSet interface.
+func (r *fakeRows) NextResultSet() error {
+	if len(r.next) == 0 {
+		return io.EOF
+	}
+	r.res, r.i, r.next = r.next[0], 0, r.next[1:]
+	return nil
+}
@@ -6,9 +6,9 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/dlclark/regexp2"
 	"github.com/jumpserver-dev/usql/feature"
 	"github.com/jumpserver-dev/usql/metacmd"
 	"github.com/jumpserver-dev/usql/store"
@@ -18,7 +18,6 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
-	"os/signal"
 	"os/user"
 	"path"
 	"path/filepath"
@@ -77,8 +76,16 @@ type Handler struct {
 	u  *dburl.URL
 	db *sql.DB
 	tx *sql.Tx
+	// pinned 会话固定使用的连接，用于在服务端取消语句
+	pinned *pinnedConn
+	// limit 当前连接生效的查询结果读取限制，打开连接时按连接名确定
+	limit feature.ResultLimit
 	// out file or pipe
 	out io.WriteCloser
+	// confirm 请求用户确认执行命令过滤规则要求确认的语句，\i 执行的文件使用调用方的终端确认
+	confirm func(rule string) (bool, error)
+	// stats 正在执行的语句的执行情况，\gexec 执行的语句嵌套在外层语句中
+	stats *execStats
 }
 
 // New creates a new input handler.
@@ -103,6 +110,7 @@ func New(l rline.IO, user *user.User, wd string, nopw bool) *Handler {
 		nopw: nopw,
 		buf:  stmt.New(f),
 	}
+	h.confirm = h.confirmStatement
 	if iactive {
 		l.SetOutput(h.outputHighlighter)
 		l.Completer(completer.NewDefaultCompleter(completer.WithConnStrings(h.connStrings())))
@@ -284,6 +292,7 @@ func (h *Handler) Run() error {
 			// run
 			opt, err = r.Run(h)
 			if err != nil && err != rline.ErrInterrupt {
+				err = feature.RedactError(err)
 				lastErr = WrapErr(cmd, err)
 				fmt.Fprintln(stderr, "error:", err)
 				continue
@@ -386,8 +395,13 @@ func (h *Handler) Run() error {
 				if h.out != nil {
 					out = h.out
 				}
-				ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-				if err = h.Execute(ctx, out, opt, h.lastPrefix, h.last, forceBatch, h.unbind()...); err != nil {
+				// 中断时取消语句
+				ctx, stop := statementContext()
+				err = h.Execute(ctx, out, opt, h.lastPrefix, h.last, forceBatch, h.unbind()...)
+				stop()
+				if err != nil {
+					// 错误信息中可能包含被脱敏的数据，显示和返回前先按脱敏规则处理
+					err = feature.RedactError(err)
 					lastErr = WrapErr(h.last, err)
 					if env.All()["ON_ERROR_STOP"] == "on" {
 						if iactive {
@@ -395,14 +409,12 @@ func (h *Handler) Run() error {
 							h.buf.Reset([]rune{}) // empty the buffer so no other statements are run
 							continue
 						} else {
-							stop()
 							return err
 						}
 					} else {
 						fmt.Fprintln(stderr, "error:", err)
 					}
 				}
-				stop()
 			}
 		}
 	}
@@ -413,26 +425,73 @@ func (h *Handler) Execute(ctx context.Context, w io.Writer, opt metacmd.Option,
 	if h.db == nil {
 		return text.ErrNotConnected
 	}
+	// 元命令、\i 和 \gexec 执行的语句都经过这里，在这里统一写审计日志
+	f := h.doExecSingle
+	switch opt.Exec {
+	case metacmd.ExecExec:
+		f = h.doExecExec
+	case metacmd.ExecSet:
+		f = h.doExecSet
+	case metacmd.ExecWatch:
+		f = h.doExecWatch
+	}
+	stats := h.beginStats(sqlstr)
+	err := h.execute(ctx, w, opt, prefix, sqlstr, forceTrans, f, bind...)
+	h.endStats(stats, err)
+	return err
+}
+
+// Columns 执行查询并返回结果列，不读取查询结果。语句与其他语句一样
+// 经过只读检查、命令过滤、审计日志和 STATEMENT_TIMEOUT 的处理
+func (h *Handler) Columns(ctx context.Context, sqlstr string) ([]string, error) {
+	if h.db == nil {
+		return nil, text.ErrNotConnected
+	}
+	var cols []string
+	stats := h.beginStats(sqlstr)
+	err := h.execute(ctx, io.Discard, metacmd.Option{}, "", sqlstr, false, func(ctx context.Context, _ io.Writer, _ metacmd.Option, _, sqlstr string, _ bool, bind []interface{}) error {
+		return h.withTimeout(ctx, func(ctx context.Context) error {
+			rows, err := h.DB().QueryContext(ctx, sqlstr, bind...)
+			if err != nil {
+				return err
+			}
+			// 不取消查询，避免中断当前事务所在的连接
+			defer rows.Close()
+			cols, err = rows.Columns()
+			return err
+		})
+	})
+	h.endStats(stats, err)
+	return cols, err
+}
+
+// execFunc 按元命令的选项执行语句的函数
+type execFunc func(ctx context.Context, w io.Writer, opt metacmd.Option, prefix, sqlstr string, qtyp bool, bind []interface{}) error
+
+// execute 处理语句，通过检查后使用 f 执行
+func (h *Handler) execute(ctx context.Context, w io.Writer, opt metacmd.Option, prefix, sqlstr string, forceTrans bool, f execFunc, bind ...interface{}) error {
 	// determine type and pre process string
 	prefix, sqlstr, qtyp, err := drivers.Process(h.u, prefix, sqlstr)
 	if err != nil {
 		return drivers.WrapErr(h.u.Driver, err)
 	}
+	// 只读模式下拒绝写语句，会话本身也以只读方式打开，这里可以在执行前给出明确的提示
+	if feature.ReadOnly() {
+		if typ, ok := feature.CheckReadOnly(h.u.Driver, sqlstr); !ok {
+			h.stats.readOnlyDenied = true
+			return fmt.Errorf(text.ReadOnlyDenied, typ)
+		}
+	}
+	// 按命令过滤规则检查语句，\gexec 和 \i 执行的语句也经过这里
+	if err := h.filterStatement(sqlstr); err != nil {
+		return err
+	}
 	// start a transaction if forced
 	if forceTrans {
 		if err = h.BeginTx(ctx, nil); err != nil {
 			return err
 		}
 	}
-	f := h.doExecSingle
-	switch opt.Exec {
-	case metacmd.ExecExec:
-		f = h.doExecExec
-	case metacmd.ExecSet:
-		f = h.doExecSet
-	case metacmd.ExecWatch:
-		f = h.doExecWatch
-	}
 	if err = drivers.WrapErr(h.u.Driver, f(ctx, w, opt, prefix, sqlstr, qtyp, bind)); err != nil {
 		if forceTrans {
 			defer h.tx.Rollback()
@@ -446,6 +505,54 @@ func (h *Handler) Execute(ctx context.Context, w io.Writer, opt metacmd.Option,
 	return nil
 }
 
+// filterStatement 按全局存储中的命令过滤规则检查语句，拒绝或未确认时返回错误
+func (h *Handler) filterStatement(sqlstr string) error {
+	v, ok := store.GetGlobalStore().Get(feature.CommandFilterKey)
+	if !ok {
+		return nil
+	}
+	rule := v.(*feature.CommandFilter).Check(h.u.Driver, sqlstr)
+	if rule == nil {
+		return nil
+	}
+	decision := &feature.FilterDecision{Rule: rule.Name, Action: rule.Action, Result: feature.FilterResultDenied}
+	h.stats.filter = decision
+	switch rule.Action {
+	case feature.CommandActionAllow:
+		decision.Result = feature.FilterResultAllowed
+		return nil
+	case feature.CommandActionConfirm:
+		confirmed, err := h.confirm(rule.Name)
+		switch {
+		case err != nil:
+			return err
+		case !confirmed:
+			decision.Result = feature.FilterResultNotConfirmed
+			return fmt.Errorf(text.CommandNotConfirmed, rule.Name)
+		}
+		decision.Result = feature.FilterResultConfirmed
+		return nil
+	}
+	return fmt.Errorf(text.CommandDenied, rule.Name)
+}
+
+// confirmStatement 在终端上请求确认执行语句，非交互模式下视为不确认
+func (h *Handler) confirmStatement(rule string) (bool, error) {
+	if !h.l.Interactive() {
+		return false, nil
+	}
+	h.l.Prompt(fmt.Sprintf(text.CommandConfirmPrompt, rule))
+	r, err := h.l.Next()
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(string(r))) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
 // Reset resets the handler's query statement buffer.
 func (h *Handler) Reset(r []rune) {
 	h.buf.Reset(r)
@@ -688,6 +795,9 @@ func (h *Handler) DB() drivers.DB {
 	if h.tx != nil {
 		return h.tx
 	}
+	if h.pinned != nil {
+		return h.pinned
+	}
 	return h.db
 }
 
@@ -758,6 +868,9 @@ func (h *Handler) Open(ctx context.Context, params ...string) error {
 	if h.tx != nil {
 		return text.ErrPreviousTransactionExists
 	}
+	// 固定的连接属于当前的连接池
+	h.unpin()
+	name := ""
 	if len(params) == 1 {
 		if ctx.Value("CHANGE_DATABASE") == "1" {
 
@@ -772,12 +885,14 @@ func (h *Handler) Open(ctx context.Context, params ...string) error {
 			h.u.DSN = newDSN
 		} else {
 			if v, ok := env.Cget(params[0]); ok {
-				params = v
+				name, params = params[0], v
 			}
 		}
 
 	}
 	if ctx.Value("CHANGE_DATABASE") != "1" {
+		// 按连接名确定查询结果的读取限制，切换数据库时仍是同一个连接，限制不变
+		h.limit = resultLimit(name)
 		if len(params) < 2 {
 			dsn := params[0]
 			// parse dsn
@@ -824,8 +939,13 @@ func (h *Handler) Open(ctx context.Context, params ...string) error {
 		defer h.Close()
 		return err
 	}
-	// reconnect
-	return h.Open(ctx, dsn)
+	// reconnect，重新打开时 DSN 已不是连接名，保留按连接名确定的限制
+	limit := h.limit
+	if err := h.Open(ctx, dsn); err != nil {
+		return err
+	}
+	h.limit = limit
+	return nil
 }
 
 func (h *Handler) connStrings() []string {
@@ -875,6 +995,10 @@ func (h *Handler) connStrings() []string {
 func (h *Handler) forceParams(u *dburl.URL) {
 	// force driver parameters
 	drivers.ForceParams(u)
+	// 只读模式下通过连接参数打开只读会话，MySQL 在驱动中逐个连接设置
+	if feature.ReadOnly() {
+		forceReadOnly(u)
+	}
 	// see if password entry is present
 	user, err := passfile.Match(u, h.user.HomeDir, text.PassfileName)
 	switch {
@@ -888,6 +1012,30 @@ func (h *Handler) forceParams(u *dburl.URL) {
 	*u = *z
 }
 
+// resultLimit 返回打开连接 name 时生效的查询结果读取限制，name 不是命名连接时使用默认限制
+func resultLimit(name string) feature.ResultLimit {
+	if limits, exists := store.GetGlobalStore().Get(feature.ResultLimitKey); exists {
+		return limits.(*feature.ResultLimits).For(name)
+	}
+	return feature.ResultLimit{}
+}
+
+// forceReadOnly 添加使会话只读的连接参数，参数在建立连接时生效，
+// 会话中执行 RESET 等语句也不会恢复为可写
+func forceReadOnly(u *dburl.URL) {
+	q := u.Query()
+	switch u.Driver {
+	case "postgres":
+		q.Set("default_transaction_read_only", "on")
+	case "clickhouse":
+		// readonly=2 仍允许客户端随查询发送设置
+		q.Set("readonly", "2")
+	default:
+		return
+	}
+	u.RawQuery = q.Encode()
+}
+
 // Password collects a password from input, and returns a modified DSN
 // including the collected password.
 func (h *Handler) Password(dsn string) (string, error) {
@@ -921,6 +1069,7 @@ func (h *Handler) Close() error {
 		return text.ErrPreviousTransactionExists
 	}
 	if h.db != nil {
+		h.unpin()
 		err := h.db.Close()
 		drv := h.u.Driver
 		h.db, h.u = nil, nil
@@ -1075,7 +1224,9 @@ func (h *Handler) doExecSingle(ctx context.Context, w io.Writer, opt metacmd.Opt
 	}
 	// exec
 	start := time.Now()
-	if err := f(ctx, w, opt, prefix, sqlstr, bind); err != nil {
+	if err := h.withTimeout(ctx, func(ctx context.Context) error {
+		return f(ctx, w, opt, prefix, sqlstr, bind)
+	}); err != nil {
 		return err
 	}
 	if h.timing {
@@ -1093,13 +1244,21 @@ func (h *Handler) doExecSingle(ctx context.Context, w io.Writer, opt metacmd.Opt
 
 // doExecSet executes a SQL query, setting all returned columns as variables.
 func (h *Handler) doExecSet(ctx context.Context, w io.Writer, opt metacmd.Option, prefix, sqlstr string, _ bool, bind []interface{}) error {
+	return h.withTimeout(ctx, func(ctx context.Context) error {
+		return h.execSet(ctx, opt, sqlstr, bind)
+	})
+}
+
+// execSet executes a SQL query, setting all returned columns as variables.
+func (h *Handler) execSet(ctx context.Context, opt metacmd.Option, sqlstr string, bind []interface{}) error {
 	// query
-	rows, err := h.DB().QueryContext(ctx, sqlstr, bind...)
+	rows, err := h.query(ctx, sqlstr, bind...)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 	// get cols
-	cols, err := drivers.Columns(h.u, rows)
+	cols, err := drivers.Columns(h.u, rows.rows)
 	if err != nil {
 		return err
 	}
@@ -1133,28 +1292,74 @@ func (h *Handler) doExecSet(ctx context.Context, w io.Writer, opt metacmd.Option
 // doExecExec executes a query and re-executes all columns of all rows as if they
 // were their own queries.
 func (h *Handler) doExecExec(ctx context.Context, w io.Writer, _ metacmd.Option, prefix, sqlstr string, qtyp bool, bind []interface{}) error {
-	// query
-	rows, err := h.DB().QueryContext(ctx, sqlstr, bind...)
+	// 先读取完结果再执行，STATEMENT_TIMEOUT 只作用于查询本身，
+	// 执行的语句也不会与未读取完的结果共用连接
+	var stmts []string
+	err := h.withTimeout(ctx, func(ctx context.Context) error {
+		// query
+		rows, err := h.query(ctx, sqlstr, bind...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		// collect resulting rows
+		if stmts, err = h.doExecRows(rows, stmts); err != nil {
+			return err
+		}
+		// check for additional result sets ...
+		for rows.NextResultSet() {
+			if stmts, err = h.doExecRows(rows, stmts); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	// exec resulting rows
-	if err := h.doExecRows(ctx, w, rows); err != nil {
-		return err
-	}
-	// check for additional result sets ...
-	for rows.NextResultSet() {
-		if err := h.doExecRows(ctx, w, rows); err != nil {
+	// execute
+	res := metacmd.Option{Exec: metacmd.ExecOnly}
+	for _, sqlstr := range stmts {
+		if err := h.Execute(ctx, w, res, stmt.FindPrefix(sqlstr, true, true, true), sqlstr, false); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// query executes a query against the database, wrapping the resulting rows so
+// that the active data masking rules are applied to every value read from
+// them, regardless of how the results are consumed.
+func (h *Handler) query(ctx context.Context, sqlstr string, bind ...interface{}) (*WarpRows, error) {
+	rows, err := h.DB().QueryContext(ctx, sqlstr, bind...)
+	if err != nil {
+		return nil, err
+	}
+	// MASKING_DEBUG 为 on 时输出每个脱敏列命中的规则，便于排查重叠的规则
+	var debug io.Writer
+	if env.Get("MASKING_DEBUG") == "on" {
+		debug = h.l.Stderr()
+	}
+	w, err := wrapRows(rows, h.u.Driver, sqlstr, h.limit, debug)
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	stats := h.stats
+	w.done = func(s feature.MaskingSummary) {
+		if stats != nil {
+			stats.rows += w.count
+			stats.truncated = stats.truncated || w.truncated
+			stats.masking.Merge(s)
+		}
+	}
+	return w, nil
+}
+
 // doQuery executes a doQuery against the database.
 func (h *Handler) doQuery(ctx context.Context, w io.Writer, opt metacmd.Option, typ, sqlstr string, bind []interface{}) error {
 	// run query
-	rows, err := h.DB().QueryContext(ctx, sqlstr, bind...)
+	rows, err := h.query(ctx, sqlstr, bind...)
 	if err != nil {
 		return err
 	}
@@ -1186,32 +1391,6 @@ func (h *Handler) doQuery(ctx context.Context, w io.Writer, opt metacmd.Option,
 		params["pager_cmd"] = env.All()["PAGER"]
 	}
 
-	var wRows *WarpRows
-	rules, exists := store.GetGlobalStore().Get(feature.DataMaskingKey)
-
-	if exists {
-		dataMaskingRules := rules.([]feature.DataMaskingRule)
-		maskIndexes := make([]int, 0)
-		maskRules := make(map[int]feature.DataMaskingRule)
-		for i := range dataMaskingRules {
-
-			dbColumns, err := rows.Columns()
-			if err != nil {
-				return err
-			}
-			for j := range dbColumns {
-				if matchRule(dataMaskingRules[i].FieldsPattern, dbColumns[j]) {
-					maskIndexes = append(maskIndexes, j)
-					maskRules[j] = dataMaskingRules[i]
-				}
-			}
-		}
-		wRows = &WarpRows{rows: rows, maskIndexes: maskIndexes, dataMaskRules: maskRules}
-
-	} else {
-		wRows = &WarpRows{rows: rows}
-	}
-
 	// set up column type config
 	var extra []tblfmt.Option
 	switch f := drivers.ColumnTypes(h.u); {
@@ -1221,7 +1400,7 @@ func (h *Handler) doQuery(ctx context.Context, w io.Writer, opt metacmd.Option,
 		extra = append(extra, tblfmt.WithUseColumnTypes(true))
 	}
 	// wrap query with crosstab
-	resultSet := tblfmt.ResultSet(wRows)
+	resultSet := tblfmt.ResultSet(rows)
 	if opt.Exec == metacmd.ExecCrosstab {
 		var err error
 		resultSet, err = tblfmt.NewCrosstabView(rows, append(extra, tblfmt.WithParams(opt.Crosstab...))...)
@@ -1234,8 +1413,20 @@ func (h *Handler) doQuery(ctx context.Context, w io.Writer, opt metacmd.Option,
 		params["lower_column_names"] = "true"
 	}
 
+	// MASKING_SUMMARY 为 on 时在表格下方显示脱敏说明，
+	// JSON 输出包装为 {"rows": ..., "masking": ...}
+	summary := env.Get("MASKING_SUMMARY") == "on"
+	// 包装时先将结果编码到缓冲区，编码成功后再整体输出，
+	// 避免出错时留下不完整的 JSON
+	jsonSummary := summary && params["format"] == "json"
+	out := w
+	var encoded bytes.Buffer
+	if jsonSummary {
+		out = &encoded
+	}
+
 	// encode and handle error conditions
-	switch err := tblfmt.EncodeAll(w, resultSet, params, extra...); {
+	switch err := tblfmt.EncodeAll(out, resultSet, params, extra...); {
 	case err != nil && cmd != nil && errors.Is(err, syscall.EPIPE):
 		// broken pipe means pager quit before consuming all data, which might be expected
 		return nil
@@ -1245,9 +1436,28 @@ func (h *Handler) doQuery(ctx context.Context, w io.Writer, opt metacmd.Option,
 		fmt.Fprintln(w, typ)
 	case err != nil:
 		return err
+	case jsonSummary:
+		buf, err := json.Marshal(rows.Summary())
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, `{"rows":%s,"masking":%s}`+"\n", bytes.TrimSpace(encoded.Bytes()), buf)
+		if err != nil && !(cmd != nil && errors.Is(err, syscall.EPIPE)) {
+			return err
+		}
 	case params["format"] == "aligned":
+		if s := rows.Summary(); summary && !s.Empty() {
+			fmt.Fprintln(w, s.Footer())
+		}
+		if rows.Truncated() {
+			fmt.Fprintf(w, "(%s)\n", fmt.Sprintf(text.ResultTruncated, rows.Count()))
+		}
 		fmt.Fprintln(w)
 	}
+	// 其他格式的输出可能由程序读取，截断的提示输出到标准错误
+	if rows.Truncated() && params["format"] != "aligned" {
+		fmt.Fprintln(h.l.Stderr(), "warning:", fmt.Sprintf(text.ResultTruncated, rows.Count()))
+	}
 	if pipe != nil {
 		pipe.Close()
 		if cmd != nil {
@@ -1257,78 +1467,30 @@ func (h *Handler) doQuery(ctx context.Context, w io.Writer, opt metacmd.Option,
 	return err
 }
 
-// 将带通配符的模式，转成安全的正则，并加上 ^...$
-func wildcardToRegexAnchored(p string) string {
-	p = strings.TrimSpace(p)
-	if p == "" {
-		return "^$"
-	}
-	// 先把用户输入整体转义，避免正则元字符被误用
-	esc := regexp.QuoteMeta(p) // 例如 "." 会变成 "\."
-	// 再把被转义的 "\*" 还原为 ".*" 以实现通配符
-	esc = strings.ReplaceAll(esc, `\*`, ".*")
-	// 最终加锚点，做到“整串匹配”
-	return "^" + esc + "$"
-}
-
-func matchRule(patterns string, name string) bool {
-	ps := strings.Split(patterns, ",")
-	for _, raw := range ps {
-		p := strings.TrimSpace(raw)
-		if p == "" {
-			continue
-		}
-
-		regex := wildcardToRegexAnchored(p)
-
-		// 忽略大小写（按需）
-		opts := regexp2.RE2 | regexp2.IgnoreCase
-		re, err := regexp2.Compile(regex, regexp2.RegexOptions(opts))
-		if err != nil {
-			// 某个模式坏了就跳过，不要整体失败
-			continue
-		}
-
-		matched, err := re.MatchString(name)
-		if err != nil {
-			continue
-		}
-		if matched {
-			return true
-		}
-	}
-	return false
-}
-
-// doExecRows executes all the columns in the row.
-func (h *Handler) doExecRows(ctx context.Context, w io.Writer, rows *sql.Rows) error {
+// doExecRows collects all the columns in the rows of the current result set
+// as statements to execute.
+func (h *Handler) doExecRows(rows *WarpRows, stmts []string) ([]string, error) {
 	// get columns
-	cols, err := drivers.Columns(h.u, rows)
+	cols, err := drivers.Columns(h.u, rows.rows)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// process rows
-	res := metacmd.Option{Exec: metacmd.ExecOnly}
 	clen, tfmt := len(cols), env.GoTime()
 	for rows.Next() {
 		if clen != 0 {
 			row, err := h.scan(rows, clen, tfmt)
 			if err != nil {
-				return err
-			}
-			// execute
-			for _, sqlstr := range row {
-				if err = h.Execute(ctx, w, res, stmt.FindPrefix(sqlstr, true, true, true), sqlstr, false); err != nil {
-					return err
-				}
+				return nil, err
 			}
+			stmts = append(stmts, row...)
 		}
 	}
-	return nil
+	return stmts, rows.Err()
 }
 
 // scan scans a row.
-func (h *Handler) scan(rows *sql.Rows, clen int, tfmt string) ([]string, error) {
+func (h *Handler) scan(rows *WarpRows, clen int, tfmt string) ([]string, error) {
 	// scan to []interface{}
 	r := make([]interface{}, clen)
 	for i := range r {
@@ -1395,6 +1557,9 @@ func (h *Handler) doExec(ctx context.Context, w io.Writer, _ metacmd.Option, typ
 		_ = env.Set("ROW_COUNT", "0")
 		return err
 	}
+	if h.stats != nil {
+		h.stats.rows += count
+	}
 	// print name
 	if env.Get("QUIET") == "off" {
 		fmt.Fprint(w, typ)
@@ -1421,7 +1586,12 @@ func (h *Handler) BeginTx(ctx context.Context, txOpts *sql.TxOptions) error {
 		return text.ErrPreviousTransactionExists
 	}
 	var err error
-	h.tx, err = h.db.BeginTx(ctx, txOpts)
+	// 在固定的连接上开始事务，以便在服务端取消事务中的语句
+	if p := h.pin(ctx); p != nil {
+		h.tx, err = p.BeginTx(ctx, txOpts)
+	} else {
+		h.tx, err = h.db.BeginTx(ctx, txOpts)
+	}
 	if err != nil {
 		return drivers.WrapErr(h.u.Driver, err)
 	}
@@ -1508,10 +1678,10 @@ func (h *Handler) Include(path string, relative bool) error {
 		Pw:  h.l.Password,
 	}
 	p := New(l, h.user, filepath.Dir(path), h.nopw)
-	p.db, p.u = h.db, h.u
+	p.db, p.u, p.pinned, p.limit, p.confirm = h.db, h.u, h.pinned, h.limit, h.confirm
 	drivers.ConfigStmt(p.u, p.buf)
 	err = p.Run()
-	h.db, h.u = p.db, p.u
+	h.db, h.u, h.pinned, h.limit = p.db, p.u, p.pinned, p.limit
 	return err
 }
 
@@ -0,0 +1,350 @@
+package handler
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jumpserver-dev/usql/feature"
+	"github.com/jumpserver-dev/usql/metacmd"
+	"github.com/jumpserver-dev/usql/store"
+	"github.com/xo/usql/env"
+)
+
+const (
+	secretPhone = "13812345678"
+	maskedPhone = "*********78"
+)
+
+// withMaskingRules 在测试中设置对 phone 列按后缀脱敏的规则
+func withMaskingRules(t *testing.T) {
+	rs, err := feature.NewRuleSet([]feature.DataMaskingRule{
+		{Name: "phone", FieldsPattern: "phone", MaskingMethod: feature.MaskingMethodKeepSuffix},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.GetGlobalStore().Set(feature.DataMaskingKey, rs)
+	t.Cleanup(func() {
+		store.GetGlobalStore().Delete(feature.DataMaskingKey)
+	})
+}
+
+// newMaskingHandler 创建查询结果包含 phone 列的 Handler
+func newMaskingHandler(t *testing.T) (*Handler, *fakeServer) {
+	withMaskingRules(t)
+	h, srv, _ := newFakeHandler(t, map[string]fakeResult{
+		"SELECT name, month, phone FROM users": {
+			cols: []string{"name", "month", "phone"},
+			rows: [][]driver.Value{{"alice", "jan", secretPhone}, {"alice", "feb", secretPhone}},
+		},
+		"SELECT phone FROM users": {
+			cols: []string{"phone"},
+			rows: [][]driver.Value{{secretPhone}},
+		},
+	})
+	return h, srv
+}
+
+func TestMaskingCrosstab(t *testing.T) {
+	h, _ := newMaskingHandler(t)
+	w := new(strings.Builder)
+	opt := metacmd.Option{Exec: metacmd.ExecCrosstab, Crosstab: []string{"name", "month", "phone"}}
+	if err := h.Execute(context.Background(), w, opt, "SELECT", "SELECT name, month, phone FROM users", false); err != nil {
+		t.Fatal(err)
+	}
+	if out := w.String(); strings.Contains(out, secretPhone) || !strings.Contains(out, maskedPhone) {
+		t.Errorf("expected crosstab output to be masked, got:\n%s", out)
+	}
+}
+
+func TestMaskingGset(t *testing.T) {
+	h, _ := newMaskingHandler(t)
+	t.Cleanup(func() {
+		_ = env.Unset("v_phone")
+	})
+	opt := metacmd.Option{Exec: metacmd.ExecSet, Params: map[string]string{"prefix": "v_"}}
+	if err := h.Execute(context.Background(), h.l.Stdout(), opt, "SELECT", "SELECT phone FROM users", false); err != nil {
+		t.Fatal(err)
+	}
+	if v := env.Get("v_phone"); v != maskedPhone {
+		t.Errorf("expected \\gset variable %q, got %q", maskedPhone, v)
+	}
+}
+
+func TestMaskingGexec(t *testing.T) {
+	h, srv := newMaskingHandler(t)
+	opt := metacmd.Option{Exec: metacmd.ExecExec}
+	// 执行的语句是脱敏后的值，假驱动按执行处理，不会出错
+	if err := h.Execute(context.Background(), h.l.Stdout(), opt, "SELECT", "SELECT phone FROM users", false); err != nil {
+		t.Fatal(err)
+	}
+	var executed bool
+	for _, q := range srv.executed() {
+		if strings.Contains(q, secretPhone) {
+			t.Errorf("\\gexec executed an unmasked value: %q", q)
+		}
+		executed = executed || q == maskedPhone
+	}
+	if !executed {
+		t.Errorf("expected \\gexec to execute %q, got %q", maskedPhone, srv.executed())
+	}
+}
+
+func TestMaskingWatch(t *testing.T) {
+	h, srv := newMaskingHandler(t)
+	w := new(strings.Builder)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	opt := metacmd.Option{Exec: metacmd.ExecWatch, Watch: 10 * time.Millisecond}
+	if err := h.Execute(ctx, w, opt, "SELECT", "SELECT phone FROM users", false); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.count("SELECT phone FROM users"); n < 2 {
+		t.Fatalf("expected \\watch to run the query repeatedly, ran %d times", n)
+	}
+	if out := w.String(); strings.Contains(out, secretPhone) || !strings.Contains(out, maskedPhone) {
+		t.Errorf("expected \\watch output to be masked, got:\n%s", out)
+	}
+}
+
+func TestMaskExplainRejectsWrites(t *testing.T) {
+	h, srv := newMaskingHandler(t)
+	for _, sqlstr := range []string{
+		"WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d",
+		"SELECT * FROM users FOR UPDATE",
+	} {
+		h.Reset([]rune(`\mask explain ` + sqlstr))
+		if err := h.Run(); err == nil || !strings.Contains(err.Error(), "read-only") {
+			t.Errorf("%s: expected statement to be rejected, got: %v", sqlstr, err)
+		}
+	}
+	if q := srv.executed(); len(q) != 0 {
+		t.Errorf("expected no statements to be executed, got %q", q)
+	}
+	h.Reset([]rune(`\mask explain SELECT phone FROM users`))
+	if err := h.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.count("SELECT phone FROM users"); n != 1 {
+		t.Errorf("expected read-only statement to be explained, ran %d times", n)
+	}
+}
+
+// withMaskingSummary 在测试中开启 MASKING_SUMMARY
+func withMaskingSummary(t *testing.T) {
+	if err := env.Set("MASKING_SUMMARY", "on"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = env.Unset("MASKING_SUMMARY")
+	})
+}
+
+func TestMaskingSummary(t *testing.T) {
+	withMaskingSummary(t)
+	h, _ := newMaskingHandler(t)
+	// aligned 格式在表格下方显示脚注
+	w := new(strings.Builder)
+	if err := h.Execute(context.Background(), w, metacmd.Option{}, "SELECT", "SELECT phone FROM users", false); err != nil {
+		t.Fatal(err)
+	}
+	if out, exp := w.String(), `(masked: phone by "phone")`; !strings.Contains(out, exp) || strings.Contains(out, secretPhone) {
+		t.Errorf("expected aligned output to contain footer %q, got:\n%s", exp, out)
+	}
+	// json 格式包装为 {"rows": ..., "masking": ...}
+	w.Reset()
+	opt := metacmd.Option{Params: map[string]string{"format": "json"}}
+	if err := h.Execute(context.Background(), w, opt, "SELECT", "SELECT phone FROM users", false); err != nil {
+		t.Fatal(err)
+	}
+	var res struct {
+		Rows    []map[string]string    `json:"rows"`
+		Masking feature.MaskingSummary `json:"masking"`
+	}
+	if err := json.Unmarshal([]byte(w.String()), &res); err != nil {
+		t.Fatalf("expected valid JSON, got: %v\n%s", err, w.String())
+	}
+	if len(res.Rows) != 1 || res.Rows[0]["phone"] != maskedPhone {
+		t.Errorf("expected rows [{phone: %q}], got %v", maskedPhone, res.Rows)
+	}
+	exp := []feature.MaskedColumn{{Column: "phone", Rule: "phone", Method: feature.MaskingMethodKeepSuffix}}
+	if cols := res.Masking.Columns; len(cols) != 1 || cols[0] != exp[0] {
+		t.Errorf("expected masking columns %v, got %v", exp, cols)
+	}
+}
+
+func TestMaskingSummaryJSONError(t *testing.T) {
+	withMaskingSummary(t)
+	withMaskingRules(t)
+	errRead := errors.New("connection reset")
+	h, _, _ := newFakeHandler(t, map[string]fakeResult{
+		"SELECT phone FROM users": {
+			cols: []string{"phone"},
+			rows: [][]driver.Value{{secretPhone}},
+			err:  errRead,
+		},
+	})
+	w := new(strings.Builder)
+	opt := metacmd.Option{Params: map[string]string{"format": "json"}}
+	if err := h.Execute(context.Background(), w, opt, "SELECT", "SELECT phone FROM users", false); !errors.Is(err, errRead) {
+		t.Fatalf("expected %v, got: %v", errRead, err)
+	}
+	// 出错时不能留下不完整的 JSON
+	if out := w.String(); out != "" {
+		t.Errorf("expected no output, got:\n%s", out)
+	}
+}
+
+func TestMaskingNull(t *testing.T) {
+	tests := []struct {
+		name string
+		rule feature.DataMaskingRule
+		exp  interface{}
+	}{
+		{"keep suffix", feature.DataMaskingRule{MaskingMethod: feature.MaskingMethodKeepSuffix}, nil},
+		{"keep suffix hide null", feature.DataMaskingRule{MaskingMethod: feature.MaskingMethodKeepSuffix, HideNull: true}, "****"},
+		{"keep suffix hide null mask char", feature.DataMaskingRule{MaskingMethod: feature.MaskingMethodKeepSuffix, HideNull: true, Params: feature.MaskingParams{MaskChar: "#"}}, "####"},
+		{"fixed char", feature.DataMaskingRule{MaskingMethod: feature.MaskingMethodFixedChar, MaskPattern: "[hidden]"}, nil},
+		{"fixed char hide null", feature.DataMaskingRule{MaskingMethod: feature.MaskingMethodFixedChar, MaskPattern: "[hidden]", HideNull: true}, "[hidden]"},
+		{"hash", feature.DataMaskingRule{MaskingMethod: feature.MaskingMethodHash}, nil},
+	}
+	h, _, _ := newFakeHandler(t, map[string]fakeResult{
+		"SELECT name, phone FROM users": {
+			cols: []string{"name", "phone"},
+			rows: [][]driver.Value{{nil, nil}, {"bob", secretPhone}},
+		},
+	})
+	opt := metacmd.Option{Params: map[string]string{"format": "json"}}
+	for _, test := range tests {
+		test.rule.Name, test.rule.FieldsPattern = "phone", "phone"
+		rs, err := feature.NewRuleSet([]feature.DataMaskingRule{test.rule})
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.GetGlobalStore().Set(feature.DataMaskingKey, rs)
+		w := new(strings.Builder)
+		if err := h.Execute(context.Background(), w, opt, "SELECT", "SELECT name, phone FROM users", false); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var rows []map[string]interface{}
+		if err := json.Unmarshal([]byte(w.String()), &rows); err != nil {
+			t.Fatalf("%s: expected valid JSON, got: %v\n%s", test.name, err, w.String())
+		}
+		// 未被脱敏的列中的 NULL 始终保留
+		if v, ok := rows[0]["name"]; !ok || v != nil {
+			t.Errorf("%s: expected unmasked NULL to be null, got %#v", test.name, v)
+		}
+		if v := rows[0]["phone"]; v != test.exp {
+			t.Errorf("%s: expected masked NULL to be %#v, got %#v", test.name, test.exp, v)
+		}
+		if v := rows[1]["phone"]; v == secretPhone || v == nil {
+			t.Errorf("%s: expected non-NULL value to be masked, got %#v", test.name, v)
+		}
+	}
+	store.GetGlobalStore().Delete(feature.DataMaskingKey)
+}
+
+func TestMaskingNullDisplay(t *testing.T) {
+	withMaskingRules(t)
+	h, _, _ := newFakeHandler(t, map[string]fakeResult{
+		"SELECT phone FROM users": {
+			cols: []string{"phone"},
+			rows: [][]driver.Value{{nil}},
+		},
+	})
+	// 保留的 NULL 按 \pset null 显示
+	w := new(strings.Builder)
+	opt := metacmd.Option{Params: map[string]string{"null": "(null)"}}
+	if err := h.Execute(context.Background(), w, opt, "SELECT", "SELECT phone FROM users", false); err != nil {
+		t.Fatal(err)
+	}
+	if out := w.String(); !strings.Contains(out, "(null)") {
+		t.Errorf("expected NULL to be displayed as %q, got:\n%s", "(null)", out)
+	}
+	// csv 输出中 NULL 与文本 'NULL' 可以区分
+	w.Reset()
+	opt = metacmd.Option{Params: map[string]string{"format": "csv", "tuples_only": "on"}}
+	if err := h.Execute(context.Background(), w, opt, "SELECT", "SELECT phone FROM users", false); err != nil {
+		t.Fatal(err)
+	}
+	if out := strings.TrimSpace(w.String()); out != "" {
+		t.Errorf("expected NULL to be written as an empty csv field, got %q", out)
+	}
+}
+
+// resultSetsQuery 返回三个列不同的结果集的语句
+const resultSetsQuery = "SELECT name, phone FROM users; SELECT phone, id, note FROM orders; SELECT note FROM logs"
+
+func TestMaskingResultSets(t *testing.T) {
+	withMaskingRules(t)
+	h, _, _ := newFakeHandler(t, map[string]fakeResult{
+		resultSetsQuery: {
+			cols: []string{"name", "phone"},
+			rows: [][]driver.Value{{"alice", secretPhone}},
+			next: []fakeResult{
+				// 第二个结果集的列不同，phone 的位置也不同
+				{cols: []string{"phone", "id", "note"}, rows: [][]driver.Value{{"13987654321", int64(1), "first order"}}},
+				{cols: []string{"note"}, rows: [][]driver.Value{{"done"}}},
+			},
+		},
+	})
+	rows, err := h.query(context.Background(), resultSetsQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var sets [][][]interface{}
+	for {
+		var set [][]interface{}
+		for rows.Next() {
+			cols, err := rows.Columns()
+			if err != nil {
+				t.Fatal(err)
+			}
+			row := make([]interface{}, len(cols))
+			for i := range row {
+				row[i] = new(interface{})
+			}
+			if err := rows.Scan(row...); err != nil {
+				t.Fatal(err)
+			}
+			for i := range row {
+				row[i] = *row[i].(*interface{})
+			}
+			set = append(set, row)
+		}
+		sets = append(sets, set)
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	exp := [][][]interface{}{
+		{{"alice", maskedPhone}},
+		{{"*********21", int64(1), "first order"}},
+		{{"done"}},
+	}
+	if len(sets) != len(exp) {
+		t.Fatalf("expected %d result sets, got %d: %v", len(exp), len(sets), sets)
+	}
+	for i := range exp {
+		if fmt.Sprint(sets[i]) != fmt.Sprint(exp[i]) {
+			t.Errorf("result set %d: expected %v, got %v", i, exp[i], sets[i])
+		}
+	}
+	var masked []string
+	for _, c := range rows.Summary().Columns {
+		masked = append(masked, fmt.Sprintf("%d:%s", c.Set, c.Column))
+	}
+	if s := strings.Join(masked, ","); s != "0:phone,1:phone" {
+		t.Errorf("expected masked columns 0:phone,1:phone, got %s", s)
+	}
+}
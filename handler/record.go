@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"io"
+
+	"github.com/jumpserver-dev/usql/feature"
+	"github.com/xo/usql/rline"
+)
+
+// recordIO 录制输入输出的 rline.IO，Password 读取的密码不会被录制
+type recordIO struct {
+	rline.IO
+	rec    *feature.Recorder
+	stdout io.Writer
+	stderr io.Writer
+	// prompt 当前的提示符，readline 直接在终端上显示提示符和回显输入，录制时补上
+	prompt string
+}
+
+// RecordIO 包装 l，将标准输出、标准错误和读取的输入写入会话录像
+func RecordIO(l rline.IO, rec *feature.Recorder) rline.IO {
+	return &recordIO{
+		IO:     l,
+		rec:    rec,
+		stdout: recordWriter{l.Stdout(), rec},
+		stderr: recordWriter{l.Stderr(), rec},
+	}
+}
+
+// Next 读取一行输入，交互模式下录制提示符和回显的输入
+func (l *recordIO) Next() ([]rune, error) {
+	r, err := l.IO.Next()
+	if err == nil && l.IO.Interactive() {
+		l.rec.Output([]byte(l.prompt + string(r) + "\n"))
+		l.rec.Input(string(r) + "\n")
+	}
+	return r, err
+}
+
+// Prompt 设置提示符
+func (l *recordIO) Prompt(s string) {
+	l.prompt = s
+	l.IO.Prompt(s)
+}
+
+// Stdout 返回录制的标准输出
+func (l *recordIO) Stdout() io.Writer {
+	return l.stdout
+}
+
+// Stderr 返回录制的标准错误
+func (l *recordIO) Stderr() io.Writer {
+	return l.stderr
+}
+
+// recordWriter 写入 w 的同时录制为终端输出
+type recordWriter struct {
+	w   io.Writer
+	rec *feature.Recorder
+}
+
+// Write satisfies the io.Writer interface.
+func (w recordWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.rec.Output(p[:n])
+	return n, err
+}
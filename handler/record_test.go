@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jumpserver-dev/usql/feature"
+	"github.com/xo/usql/rline"
+)
+
+// recordEvent asciicast v2 的一个事件
+type recordEvent struct {
+	time float64
+	typ  string
+	data string
+}
+
+// readRecording 解析录像的文件头和事件
+func readRecording(t *testing.T, s string) (map[string]interface{}, []recordEvent) {
+	t.Helper()
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	var header map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil {
+		t.Fatalf("invalid header %q: %v", lines[0], err)
+	}
+	var events []recordEvent
+	for _, line := range lines[1:] {
+		var v []interface{}
+		if err := json.Unmarshal([]byte(line), &v); err != nil || len(v) != 3 {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		ts, ok1 := v[0].(float64)
+		typ, ok2 := v[1].(string)
+		data, ok3 := v[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			t.Fatalf("invalid event %q", line)
+		}
+		events = append(events, recordEvent{ts, typ, data})
+	}
+	return header, events
+}
+
+func TestRecordIO(t *testing.T) {
+	testRecordIO(t, true)
+}
+
+// 非交互模式下没有提示符和回显，不录制输入
+func TestRecordIONonInteractive(t *testing.T) {
+	testRecordIO(t, false)
+}
+
+// testRecordIO 录制一个简短的会话并检查录像的文件头和事件
+func testRecordIO(t *testing.T, interactive bool) {
+	t.Helper()
+	input := []string{"select 1", `\q`}
+	out, buf := new(bytes.Buffer), new(bytes.Buffer)
+	l := &rline.Rline{
+		N: func() ([]rune, error) {
+			if len(input) == 0 {
+				return nil, io.EOF
+			}
+			s := input[0]
+			input = input[1:]
+			return []rune(s), nil
+		},
+		Out: out,
+		Err: out,
+		Int: interactive,
+		Pw: func(string) (string, error) {
+			return "secret", nil
+		},
+	}
+	start := time.Now().Unix()
+	rec, err := feature.NewRecorder(buf, 100, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := RecordIO(l, rec)
+	// 会话：输入语句、输出结果和错误、读取密码、分两次写入的多字节字符
+	r.Prompt("db=> ")
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(r.Stdout(), "a\nb\r\n")
+	fmt.Fprint(r.Stderr(), "error: x\n")
+	if pw, err := r.Password("Password: "); err != nil || pw != "secret" {
+		t.Fatalf("expected password %q, got %q: %v", "secret", pw, err)
+	}
+	zh := []byte("张")
+	r.Stdout().Write(zh[:2])
+	r.Stdout().Write(zh[2:])
+	r.Prompt("db-> ")
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("expected EOF, got: %v", err)
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if s := out.String(); s != "a\nb\r\nerror: x\n张" {
+		t.Errorf("expected output to be passed through unchanged, got %q", s)
+	}
+	header, events := readRecording(t, buf.String())
+	if header["version"] != float64(2) || header["width"] != float64(100) || header["height"] != float64(30) {
+		t.Errorf("expected v2 header with size 100x30, got %v", header)
+	}
+	if ts, _ := header["timestamp"].(float64); int64(ts) < start || int64(ts) > time.Now().Unix() {
+		t.Errorf("expected header timestamp to be the start time, got %v", header["timestamp"])
+	}
+	var exp []recordEvent
+	if interactive {
+		exp = append(exp, recordEvent{0, "o", "db=> select 1\r\n"}, recordEvent{0, "i", "select 1\n"})
+	}
+	exp = append(exp, recordEvent{0, "o", "a\r\nb\r\n"}, recordEvent{0, "o", "error: x\r\n"}, recordEvent{0, "o", "张"})
+	if interactive {
+		exp = append(exp, recordEvent{0, "o", "db-> \\q\r\n"}, recordEvent{0, "i", "\\q\n"})
+	}
+	if len(events) != len(exp) {
+		t.Fatalf("expected %d events, got %d: %v", len(exp), len(events), events)
+	}
+	var last float64
+	for i, e := range events {
+		if e.typ != exp[i].typ || e.data != exp[i].data {
+			t.Errorf("event %d: expected [%q, %q], got [%q, %q]", i, exp[i].typ, exp[i].data, e.typ, e.data)
+		}
+		if e.time < last {
+			t.Errorf("event %d: time %f is before the previous event %f", i, e.time, last)
+		}
+		last = e.time
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Error("expected the password not to be recorded")
+	}
+}
@@ -2,119 +2,224 @@ package handler
 
 import (
 	"database/sql"
+	"fmt"
 	"github.com/jumpserver-dev/usql/feature"
-	"strings"
+	"github.com/jumpserver-dev/usql/store"
+	"io"
 )
 
 // WarpRows 是对 sql.Rows 的包装，支持按列索引脱敏
 type WarpRows struct {
-	rows          *sql.Rows
-	maskIndexes   []int
-	temp          []interface{}
-	dataMaskRules map[int]feature.DataMaskingRule
+	rows *sql.Rows
+	temp []interface{}
+	// row 当前行脱敏后的值，在 Next 中读取，以便在返回前按字节数限制检查
+	row []interface{}
+	// maskPlan 当前结果集的脱敏方案，按列下标查找规则
+	maskPlan *feature.MaskPlan
+	// kinds 每一列的数据类别，用于选择按类型脱敏的策略
+	kinds []feature.ColumnKind
+	// plan 按结果集的列计算脱敏方案，为空时不脱敏
+	plan func(set int, cols []string) (*feature.MaskPlan, error)
+	// set 当前结果集的序号
+	set int
+	// err 切换结果集时计算脱敏方案的错误
+	err error
+	// debug 不为空时输出每个结果集的规则选择结果
+	debug io.Writer
+	// detector 按内容识别敏感数据，为空时不识别
+	detector *feature.Detector
+	// scan 当前结果集的内容识别状态，cols 为当前结果集的列名
+	scan *feature.DetectScan
+	cols []string
+	// summary 各结果集的脱敏情况，done 在关闭时接收
+	summary feature.MaskingSummary
+	done    func(feature.MaskingSummary)
+	// count 已读取的行数，bytes 已读取的值的字节数
+	count int64
+	bytes int64
+	// limit 读取的行数和字节数的限制，超过限制时关闭结果并设置 truncated
+	limit     feature.ResultLimit
+	truncated bool
 }
 
-// NewWarpRows 构造函数
-func NewWarpRows(rows *sql.Rows, maskIndexes []int) *WarpRows {
-	return &WarpRows{
-		rows:        rows,
-		maskIndexes: maskIndexes,
+// wrapRows 按全局存储中的脱敏规则和内容识别器包装查询结果，都没有时只做代理。
+// debug 不为空时向其输出每个脱敏列命中的规则
+func wrapRows(rows *sql.Rows, driver, sqlstr string, limit feature.ResultLimit, debug io.Writer) (*WarpRows, error) {
+	w := &WarpRows{rows: rows, limit: limit, debug: debug}
+	if rules, exists := store.GetGlobalStore().Get(feature.DataMaskingKey); exists {
+		rs, d := rules.(*feature.RuleSet), feature.DialectFor(driver)
+		w.plan = func(set int, cols []string) (*feature.MaskPlan, error) {
+			return rs.Plan(d, sqlstr, set, cols)
+		}
+	}
+	if detector, exists := store.GetGlobalStore().Get(feature.DataDetectorKey); exists {
+		w.detector = detector.(*feature.Detector)
 	}
+	if err := w.replan(); err != nil {
+		return nil, err
+	}
+	return w, nil
 }
 
-// Next 代理
-func (w *WarpRows) Next() bool {
-	return w.rows.Next()
+// replan 按当前结果集的列重新计算脱敏方案，并重置扫描缓存和内容识别状态
+func (w *WarpRows) replan() error {
+	w.finish()
+	w.temp, w.row, w.kinds = nil, nil, nil
+	if w.plan == nil && w.detector == nil {
+		return nil
+	}
+	cols, err := w.rows.Columns()
+	if err != nil {
+		return err
+	}
+	w.cols = cols
+	if w.detector != nil {
+		w.scan = w.detector.NewScan(len(cols))
+	}
+	if w.plan == nil {
+		return nil
+	}
+	if w.maskPlan, err = w.plan(w.set, cols); err != nil {
+		return err
+	}
+	w.summary.Columns = append(w.summary.Columns, w.maskPlan.Masked(w.set, cols)...)
+	if w.debug != nil {
+		for _, line := range w.maskPlan.Explain(cols) {
+			fmt.Fprintf(w.debug, "DEBUG: masking result set %d: %s\n", w.set, line)
+		}
+	}
+	return nil
 }
 
-// Scan 对行进行读取并按规则脱敏
-func (w *WarpRows) Scan(dest ...interface{}) error {
-	// 初始化 temp 缓存
-	if w.temp == nil {
-		w.temp = make([]interface{}, len(dest))
-		for i := range w.temp {
-			w.temp[i] = new(interface{})
+// finish 结束当前结果集的内容识别，汇总各列的命中次数
+func (w *WarpRows) finish() {
+	if w.scan == nil {
+		return
+	}
+	for _, d := range w.scan.Detections(w.set, w.cols) {
+		w.summary.Detections = append(w.summary.Detections, d)
+		if w.debug != nil {
+			fmt.Fprintf(w.debug, "DEBUG: DLP result set %d: column %q: %d %s\n", w.set, d.Column, d.Count, d.Kind)
 		}
 	}
+	w.scan = nil
+}
 
-	// 先 scan 到 temp
-	if err := w.rows.Scan(w.temp...); err != nil {
-		return err
+// Summary 返回已读取的结果集的脱敏情况
+func (w *WarpRows) Summary() feature.MaskingSummary {
+	w.finish()
+	return w.summary
+}
+
+// Next 读取下一行并按规则脱敏，结果集读取完时结束内容识别。下一行超过
+// 读取限制时丢弃该行，关闭结果并标记为已截断
+func (w *WarpRows) Next() bool {
+	if w.truncated || w.err != nil {
+		return false
+	}
+	if !w.rows.Next() {
+		w.finish()
+		return false
+	}
+	if w.limit.MaxRows > 0 && w.count >= w.limit.MaxRows {
+		w.truncate()
+		return false
+	}
+	size, err := w.read()
+	if err != nil {
+		w.err = err
+		return false
+	}
+	// 按脱敏后的值计算字节数，单独一行超过限制时也不返回
+	if w.limit.MaxBytes > 0 && w.bytes+size > w.limit.MaxBytes {
+		w.truncate()
+		return false
 	}
+	w.bytes += size
+	w.count++
+	return true
+}
 
-	// 遍历每一列，赋值到用户传入的 dest
-	for i := range dest {
-		src := *w.temp[i].(*interface{})
-		if contains(w.maskIndexes, i) {
-			rule, ok := w.dataMaskRules[i]
-			val := rule.MaskPattern
-
-			if ok {
-				switch src.(type) {
-				case []byte:
-					val = replaceColumnVal(rule, string(src.([]byte)))
-				case *string:
-					val = replaceColumnVal(rule, *(src.(*string)))
-				case *sql.NullString:
-					if src.(*sql.NullString).Valid {
-						val = replaceColumnVal(rule, src.(*sql.NullString).String)
-					}
-				case string:
-					val = replaceColumnVal(rule, src.(string))
-				}
-				if src != nil {
-					dest[i] = val
-				} else {
-					dest[i] = "NULL"
-				}
-			}
+// truncate 因达到读取限制关闭结果
+func (w *WarpRows) truncate() {
+	w.truncated = true
+	w.finish()
+	w.rows.Close()
+}
+
+// Truncated 判断结果是否因达到读取限制被截断
+func (w *WarpRows) Truncated() bool {
+	return w.truncated
+}
+
+// Count 返回已读取的行数
+func (w *WarpRows) Count() int64 {
+	return w.count
+}
+
+// Scan 返回 Next 读取的脱敏后的值。值写入 *interface{} 类型的 dest，
+// 其他类型的 dest 替换为指向值的 *interface{}，NULL 仍为 nil
+func (w *WarpRows) Scan(dest ...interface{}) error {
+	if w.row == nil {
+		return sql.ErrNoRows
+	}
+	if len(dest) != len(w.row) {
+		return fmt.Errorf("sql: expected %d destination arguments in Scan, not %d", len(w.row), len(dest))
+	}
+	for i, v := range w.row {
+		if p, ok := dest[i].(*interface{}); ok {
+			*p = v
 		} else {
-			if src != nil {
-				dest[i] = src
-			} else {
-				dest[i] = "NULL"
-			}
+			dest[i] = &v
 		}
 	}
 	return nil
-
 }
 
-func replaceColumnVal(rule feature.DataMaskingRule, val string) string {
-	switch rule.MaskingMethod {
-	case feature.MaskingMethodFixedChar:
-		// 固定字符替换
-		if rule.MaskPattern == "" {
-			return rule.MaskPattern
+// read 读取当前行并按规则脱敏，返回脱敏后的值的字节数
+func (w *WarpRows) read() (int64, error) {
+	// 初始化 temp 缓存
+	if w.temp == nil {
+		cols, err := w.rows.Columns()
+		if err != nil {
+			return 0, err
 		}
-		return rule.MaskPattern
-
-	case feature.MaskingMethodHideMiddle:
-		// 隐藏中间
-		if len(val) < 3 {
-			return rule.MaskPattern
+		w.temp, w.row = make([]interface{}, len(cols)), make([]interface{}, len(cols))
+		for i := range w.temp {
+			w.temp[i] = new(interface{})
 		}
-		return val[:1] + strings.Repeat("*", len(val)-2) + val[len(val)-1:]
+		w.kinds = columnKinds(w.rows, len(cols))
+	}
 
-	case feature.MaskingMethodKeepPrefix:
-		// 保留前缀
-		n := 2
-		if n <= 0 || n >= len(val) {
-			return "####"
-		}
-		return val[:n] + strings.Repeat("*", len(val)-n)
+	// 先 scan 到 temp
+	if err := w.rows.Scan(w.temp...); err != nil {
+		return 0, err
+	}
 
-	case feature.MaskingMethodKeepSuffix:
-		// 保留后缀
-		n := 2
-		if n <= 0 || n >= len(val) {
-			return "####"
+	// 按抽样比例决定是否对该行做内容识别
+	sampled := w.scan != nil && w.scan.Row()
+
+	// 遍历每一列，赋值到 row
+	var size int64
+	for i := range w.row {
+		src := *w.temp[i].(*interface{})
+		switch rule := w.maskPlan.Rule(i); {
+		case rule == nil && w.scan != nil && src != nil && (w.kinds[i] == feature.KindText || w.kinds[i] == feature.KindNumeric):
+			// 没有规则的列按内容识别敏感数据
+			w.row[i] = w.scan.Value(i, sampled, src)
+		case rule == nil:
+			w.row[i] = src
+		case src != nil:
+			w.row[i] = rule.MaskValue(w.kinds[i], src)
+		default:
+			// 保留 NULL，由 tblfmt 按 \pset null 显示
+			w.row[i] = rule.NullValue()
+		}
+		if w.limit.MaxBytes > 0 {
+			size += feature.ValueSize(w.row[i])
 		}
-		return strings.Repeat("*", len(val)-n) + val[len(val)-n:]
-	default:
-		// 未知策略
-		return rule.MaskPattern
 	}
+	return size, nil
 }
 
 // Columns 代理
@@ -127,29 +232,48 @@ func (w *WarpRows) ColumnTypes() ([]*sql.ColumnType, error) {
 	return w.rows.ColumnTypes()
 }
 
-// Close 代理
+// Close 代理，并将脱敏情况交给 done
 func (w *WarpRows) Close() error {
+	w.finish()
+	if w.done != nil {
+		w.done(w.summary)
+		w.done = nil
+	}
 	return w.rows.Close()
 }
 
 // Err 代理
 func (w *WarpRows) Err() error {
+	if w.err != nil {
+		return w.err
+	}
 	return w.rows.Err()
 }
 
-// NextResultSet 代理
+// NextResultSet 切换到下一个结果集，并按新结果集的列重新计算脱敏方案
 func (w *WarpRows) NextResultSet() bool {
-	return w.rows.NextResultSet()
+	if w.err != nil || w.truncated || !w.rows.NextResultSet() {
+		return false
+	}
+	w.set++
+	if err := w.replan(); err != nil {
+		w.err = err
+		return false
+	}
+	return true
 }
 
 // ---------------- 工具函数 ----------------
 
-// contains 判断 index 是否在 maskIndexes 中
-func contains(indexes []int, target int) bool {
-	for _, i := range indexes {
-		if i == target {
-			return true
-		}
+// columnKinds 根据 ColumnTypes 获取每一列的数据类别，驱动不支持时都按文本处理
+func columnKinds(rows *sql.Rows, n int) []feature.ColumnKind {
+	kinds := make([]feature.ColumnKind, n)
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return kinds
+	}
+	for i := 0; i < n && i < len(types); i++ {
+		kinds[i] = feature.ColumnKindOf(types[i])
 	}
-	return false
+	return kinds
 }
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/jumpserver-dev/usql/feature"
+	"github.com/jumpserver-dev/usql/store"
+)
+
+func TestResultLimit(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	tests := []struct {
+		name      string
+		limit     feature.ResultLimit
+		sqlstr    string
+		exp       int64
+		truncated bool
+	}{
+		{"no limit", feature.ResultLimit{}, "SELECT short", 3, false},
+		{"max rows", feature.ResultLimit{MaxRows: 2}, "SELECT short", 2, true},
+		{"max rows not reached", feature.ResultLimit{MaxRows: 3}, "SELECT short", 3, false},
+		{"max bytes", feature.ResultLimit{MaxBytes: 5}, "SELECT short", 2, true},
+		{"max bytes exact", feature.ResultLimit{MaxBytes: 6}, "SELECT short", 3, false},
+		{"oversized first row", feature.ResultLimit{MaxBytes: 10}, "SELECT long", 0, true},
+	}
+	h, _, _ := newFakeHandler(t, map[string]fakeResult{
+		"SELECT short": {cols: []string{"v"}, rows: [][]driver.Value{{"ab"}, {"cd"}, {"ef"}}},
+		"SELECT long":  {cols: []string{"v"}, rows: [][]driver.Value{{long}, {"a"}}},
+	})
+	for _, test := range tests {
+		h.limit = test.limit
+		rows, err := h.query(context.Background(), test.sqlstr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int64
+		for rows.Next() {
+			var v interface{}
+			if err := rows.Scan(&v); err != nil {
+				t.Fatal(err)
+			}
+			if s, _ := v.(string); len(s) > 10 {
+				t.Errorf("%s: returned a value of %d bytes", test.name, len(s))
+			}
+			n++
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+		if n != test.exp || rows.Count() != test.exp || rows.Truncated() != test.truncated {
+			t.Errorf("%s: expected %d rows truncated %t, got %d (count %d) truncated %t", test.name, test.exp, test.truncated, n, rows.Count(), rows.Truncated())
+		}
+	}
+}
+
+func TestResultLimitForConnection(t *testing.T) {
+	store.GetGlobalStore().Set(feature.ResultLimitKey, &feature.ResultLimits{
+		Default: feature.ResultLimit{MaxRows: 100, MaxBytes: 1000},
+		Conns: map[string]feature.ResultLimit{
+			"prod": {MaxRows: 10},
+			"wide": {MaxRows: 1000, MaxBytes: 500},
+		},
+	})
+	t.Cleanup(func() {
+		store.GetGlobalStore().Delete(feature.ResultLimitKey)
+	})
+	tests := []struct {
+		name string
+		exp  feature.ResultLimit
+	}{
+		{"", feature.ResultLimit{MaxRows: 100, MaxBytes: 1000}},
+		{"prod", feature.ResultLimit{MaxRows: 10, MaxBytes: 1000}},
+		{"wide", feature.ResultLimit{MaxRows: 100, MaxBytes: 500}},
+	}
+	for _, test := range tests {
+		if limit := resultLimit(test.name); limit != test.exp {
+			t.Errorf("%q: expected %+v, got %+v", test.name, test.exp, limit)
+		}
+	}
+}
@@ -300,6 +300,31 @@ func init() {
 				return m.ShowStats(p.Handler.URL(), name, pattern, verbose, k)
 			},
 		},
+		Mask: {
+			Section: SectionInformational,
+			Name:    "mask",
+			Desc:    Desc{"list active data masking rules", "[list]"},
+			Aliases: map[string]Desc{
+				"mask ":  {"show which result columns each data masking rule matches", "explain QUERY"},
+				"mask  ": {"show the masked output of a value", "try METHOD VALUE [MASK_PATTERN]"},
+			},
+			Process: func(p *Params) error {
+				sub, err := p.Get(true)
+				if err != nil {
+					return err
+				}
+				stdout := p.Handler.IO().Stdout()
+				switch sub {
+				case "", "list":
+					return maskList(stdout)
+				case "explain":
+					return maskExplain(p, stdout)
+				case "try":
+					return maskTry(p, stdout)
+				}
+				return fmt.Errorf(text.InvalidOption, sub)
+			},
+		},
 	}
 	// set up map
 	cmdMap = make(map[string]Metacmd, len(cmds))
@@ -0,0 +1,183 @@
+package metacmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jumpserver-dev/usql/feature"
+	"github.com/jumpserver-dev/usql/store"
+	"github.com/xo/usql/drivers"
+	"github.com/xo/usql/stmt"
+	"github.com/xo/usql/text"
+)
+
+// errNoMaskingRules 当前会话没有脱敏规则
+var errNoMaskingRules = errors.New(`\mask: no data masking rules are active`)
+
+// errMaskNotQuery \mask explain 的语句不返回结果集
+var errMaskNotQuery = errors.New(`\mask explain: statement does not return rows`)
+
+// errMaskNotReadOnly \mask explain 的语句可能修改数据
+var errMaskNotReadOnly = errors.New(`\mask explain: only read-only statements can be explained`)
+
+// maskRuleSet 返回全局存储中的脱敏规则集合
+func maskRuleSet() (*feature.RuleSet, bool) {
+	v, ok := store.GetGlobalStore().Get(feature.DataMaskingKey)
+	if !ok {
+		return nil, false
+	}
+	rs, ok := v.(*feature.RuleSet)
+	return rs, ok
+}
+
+// maskList 列出当前会话的脱敏规则。规则中不包含密钥，令牌化密钥不会显示
+func maskList(w io.Writer) error {
+	rs, ok := maskRuleSet()
+	if !ok {
+		return errNoMaskingRules
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tName\tMethod\tPriority\tFields\tDatabase\tSchema\tTable\tOptions")
+	for i, r := range rs.Rules() {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			i, r.Name, r.MaskingMethod, r.Priority,
+			r.FieldsPattern, r.DatabasePattern, r.SchemaPattern, r.TablePattern,
+			maskRuleOptions(r),
+		)
+	}
+	return tw.Flush()
+}
+
+// maskRuleOptions 返回规则中设置了的选项
+func maskRuleOptions(r feature.DataMaskingRule) string {
+	var opts []string
+	add := func(name string, v interface{}) {
+		opts = append(opts, fmt.Sprintf("%s=%v", name, v))
+	}
+	if r.MaskPattern != "" {
+		add("mask_pattern", strconv.Quote(r.MaskPattern))
+	}
+	p := r.Params
+	if p.PrefixLength != nil {
+		add("prefix_length", *p.PrefixLength)
+	}
+	if p.SuffixLength != nil {
+		add("suffix_length", *p.SuffixLength)
+	}
+	if p.MaskChar != "" {
+		add("mask_char", strconv.Quote(p.MaskChar))
+	}
+	if p.MinVisibleLength != 0 {
+		add("min_visible_length", p.MinVisibleLength)
+	}
+	if p.Replacement != "" {
+		add("replacement", strconv.Quote(p.Replacement))
+	}
+	if p.TokenLength != 0 {
+		add("token_length", p.TokenLength)
+	}
+	if p.NumericStrategy != "" {
+		add("numeric_strategy", p.NumericStrategy)
+	}
+	if p.NumericStep != 0 {
+		add("numeric_step", p.NumericStep)
+	}
+	if p.DatePrecision != "" {
+		add("date_precision", p.DatePrecision)
+	}
+	if r.HideNull {
+		add("hide_null", r.HideNull)
+	}
+	if r.ComputedPolicy != "" {
+		add("computed_policy", r.ComputedPolicy)
+	}
+	if r.UnresolvedPolicy != "" {
+		add("unresolved_policy", r.UnresolvedPolicy)
+	}
+	return strings.Join(opts, " ")
+}
+
+// maskExplain 执行查询获取结果列，显示每条规则匹配到的列，查询结果不会显示。
+// 查询与其他语句一样经过只读检查、命令过滤和审计；不是只读模式时也只接受只读的语句，
+// 避免查看规则时执行 WITH d AS (DELETE ...) SELECT ... 等修改数据的语句
+func maskExplain(p *Params, w io.Writer) error {
+	rs, ok := maskRuleSet()
+	if !ok {
+		return errNoMaskingRules
+	}
+	sqlstr := strings.TrimRight(strings.TrimSpace(p.GetRaw()), "; \t\r\n")
+	if sqlstr == "" {
+		return fmt.Errorf(text.MissingRequiredArg, p.Name+" explain")
+	}
+	if p.Handler.DB() == nil {
+		return text.ErrNotConnected
+	}
+	if _, isQuery := drivers.QueryExecType(stmt.FindPrefix(sqlstr, true, true, true), sqlstr); !isQuery {
+		return errMaskNotQuery
+	}
+	if _, ok := feature.CheckReadOnly(p.Handler.URL().Driver, sqlstr); !ok {
+		return errMaskNotReadOnly
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	cols, err := p.Handler.Columns(ctx, sqlstr)
+	if err != nil {
+		return err
+	}
+	matches, err := rs.Explain(feature.DialectFor(p.Handler.URL().Driver), sqlstr, 0, cols)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tName\tMethod\tColumns\tOverridden")
+	for i, m := range matches {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", i, m.Rule.Name, m.Rule.MaskingMethod,
+			strings.Join(m.Columns, ", "), strings.Join(m.Overridden, ", "))
+	}
+	return tw.Flush()
+}
+
+// maskTry 按指定的脱敏方法处理一个值并显示结果
+func maskTry(p *Params, w io.Writer) error {
+	method, err := p.Get(true)
+	if err != nil {
+		return err
+	}
+	value, err := p.Get(true)
+	if err != nil {
+		return err
+	}
+	pattern, err := p.Get(true)
+	if err != nil {
+		return err
+	}
+	if method == "" {
+		return fmt.Errorf(text.MissingRequiredArg, p.Name+" try")
+	}
+	rule := feature.DataMaskingRule{
+		Name:          "try",
+		FieldsPattern: "*",
+		MaskingMethod: method,
+		MaskPattern:   pattern,
+	}
+	if err := feature.ValidateRules([]feature.DataMaskingRule{rule}); err != nil {
+		var verr *feature.ValidationError
+		if errors.As(err, &verr) {
+			e := verr.Errors[0]
+			return fmt.Errorf(`\%s try: %s: %w`, p.Name, e.Field, e.Err)
+		}
+		return err
+	}
+	if err := rule.Compile(); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, rule.Mask(value))
+	return nil
+}
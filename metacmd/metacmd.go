@@ -94,4 +94,6 @@ const (
 	Timing
 	// Stats is the show stats meta command (\ss and variants).
 	Stats
+	// Mask is the data masking meta command (\mask list, explain, try).
+	Mask
 )
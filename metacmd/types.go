@@ -27,6 +27,8 @@ type Handler interface {
 	URL() *dburl.URL
 	// DB returns the current database connection.
 	DB() drivers.DB
+	// Columns returns the result columns of a query without reading its rows.
+	Columns(context.Context, string) ([]string, error)
 	// Last returns the last executed query.
 	Last() string
 	// LastRaw returns the last raw (non-interpolated) query.
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/jumpserver-dev/usql/feature"
@@ -14,7 +13,9 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
@@ -24,6 +25,7 @@ import (
 	"github.com/xo/usql/env"
 	"github.com/xo/usql/rline"
 	"github.com/xo/usql/text"
+	"golang.org/x/term"
 )
 
 // ContextExecutor is the command context.
@@ -159,6 +161,26 @@ func New(cliargs []string) ContextExecutor {
 	flags.VarP(filevar{&args.Out}, "out", "o", "output file")
 	flags.BoolVarP(&args.ForcePassword, "password", "W", false, "force password prompt (should happen automatically)")
 	flags.BoolVarP(&args.SingleTransaction, "single-transaction", "1", false, "execute as a single transaction (if non-interactive)")
+	flags.DurationVar(&args.StatementTimeout, "statement-timeout", 0, "cancel statements running longer than DURATION, on the server where supported (sets STATEMENT_TIMEOUT)")
+	flags.Int64Var(&args.MaxRows, "max-rows", 0, "stop reading a query result after N rows (0 for no limit)")
+	flags.Int64Var(&args.MaxResultBytes, "max-result-bytes", 0, "stop reading a query result after N bytes of values (0 for no limit)")
+	flags.StringVar(&args.Record, "record", "", "record the session to FILE in asciicast v2 format (password input is not recorded)")
+	flags.BoolVar(&args.ReadOnly, "read-only", false, "reject statements that modify data and open read-only sessions")
+
+	// data masking flags
+	flags.StringVar(&args.MaskingRulesFile, "masking-rules-file", "", "read data masking rules (JSON) from FILE")
+	flags.IntVar(&args.MaskingRulesFD, "masking-rules-fd", -1, "read data masking rules (JSON) from inherited file descriptor N")
+	flags.BoolVar(&args.RequireSignedMasking, "require-signed-masking", false, "refuse to connect without a verified signed data masking rule bundle")
+	flags.BoolVar(&args.LenientMasking, "lenient-masking", false, "start even if data masking rules are invalid (invalid rules are reported and applied as far as possible)")
+	flags.StringVar(&args.MaskingPublicKey, "masking-public-key", "", "ed25519 public key FILE to verify data masking rule bundles")
+	flags.BoolVar(&args.DLPScan, "dlp-scan", false, "detect and mask ID numbers, bank cards, mobile numbers and emails in result values")
+	flags.Float64Var(&args.DLPSampleRate, "dlp-sample-rate", 1, "fraction of rows scanned by --dlp-scan, columns with detections are always scanned")
+	flags.VarPF(vs{&args.DLPPatterns, nil, "NAME=REGEXP"}, "dlp-pattern", "", "custom pattern detected and masked in result values (implies --dlp-scan)")
+	flags.StringVar(&args.CommandFilterFile, "command-filter-file", "", "read command filter rules (JSON) from FILE")
+	flags.IntVar(&args.CommandFilterFD, "command-filter-fd", -1, "read command filter rules (JSON) from inherited file descriptor N")
+	flags.StringVar(&args.SessionID, "session-id", "", "session ID that signed data masking rule bundles are bound to, recorded in the audit log")
+	flags.StringVar(&args.AuditLog, "audit-log", "", "write a JSON line for every executed statement to FILE, or to unix:PATH for a unix socket")
+	flags.IntVar(&args.AuditLogFD, "audit-log-fd", -1, "write the audit log to inherited file descriptor N")
 
 	ss := func(v *[]string, name, short, usage, placeholder string, vals ...string) {
 		f := flags.VarPF(vs{v, vals, placeholder}, name, short, usage)
@@ -266,6 +288,12 @@ func Run(ctx context.Context, args *Args, connections map[string]interface{}, in
 
 	// fmt.Fprintf(os.Stdout, "VARS: %v\nCVARS: %v\nPVARS: %v\n", args.Vars, args.Cvars, args.Pvars)
 
+	// --statement-timeout 是 STATEMENT_TIMEOUT 变量的简写
+	if args.StatementTimeout > 0 {
+		if err := env.Set("STATEMENT_TIMEOUT", args.StatementTimeout.String()); err != nil {
+			return err
+		}
+	}
 	// set vars
 	for _, v := range args.Vars {
 		if i := strings.Index(v, "="); i != -1 {
@@ -316,6 +344,28 @@ func Run(ctx context.Context, args *Args, connections map[string]interface{}, in
 		return err
 	}
 	defer l.Close()
+	// 录制会话，密码输入不会被录制
+	if args.Record != "" {
+		f, err := os.OpenFile(args.Record, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		width, height, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil || width == 0 || height == 0 {
+			width, height = 80, 24
+		}
+		rec, err := feature.NewRecorder(f, width, height)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := rec.Err(); err != nil {
+				fmt.Fprintln(os.Stderr, "error: session recording:", err)
+			}
+		}()
+		l = handler.RecordIO(l, rec)
+	}
 	// create handler
 	h := handler.New(l, u, wd, args.NoPassword)
 	// force password
@@ -340,21 +390,122 @@ func Run(ctx context.Context, args *Args, connections map[string]interface{}, in
 		return err
 	}
 
-	if values.Has(feature.DataMaskingKey) {
-		rulesJson := values.Get(feature.DataMaskingKey)
-		var rules []feature.DataMaskingRule
-		if err := json.Unmarshal([]byte(rulesJson), &rules); err != nil {
+	stripped := values.Has(feature.DataMaskingKey) || values.Has(feature.CommandFilterKey)
+	// 脱敏规则可以通过文件、继承的文件描述符、环境变量或 DSN 参数传入，
+	// 后三者不会出现在 ps 和 /proc/*/cmdline 中
+	rules, ok, err := ruleSource{
+		name: "data masking rules",
+		file: args.MaskingRulesFile,
+		fd:   args.MaskingRulesFD,
+		env:  text.CommandUpper() + "_DATA_MASKING_RULES",
+	}.read(values, feature.DataMaskingKey)
+	if err != nil {
+		return err
+	}
+	if ok || args.RequireSignedMasking {
+		publicKey, err := feature.LoadPublicKey(args.MaskingPublicKey)
+		if err != nil {
+			return err
+		}
+		ruleSet, err := feature.LoadDataMaskingRules(rules, feature.LoadOptions{
+			PublicKey:     publicKey,
+			Session:       args.SessionID,
+			RequireSigned: args.RequireSignedMasking,
+			Lenient:       args.LenientMasking,
+			Warn: func(err error) {
+				fmt.Fprintln(os.Stderr, "warning:", err)
+			},
+		})
+		if err != nil {
+			return err
+		}
+		store.GetGlobalStore().Set(feature.DataMaskingKey, ruleSet)
+	}
+
+	// 命令过滤规则与脱敏规则的来源相同
+	filterRules, ok, err := ruleSource{
+		name: "command filter rules",
+		file: args.CommandFilterFile,
+		fd:   args.CommandFilterFD,
+		env:  text.CommandUpper() + "_COMMAND_FILTER_RULES",
+	}.read(values, feature.CommandFilterKey)
+	if err != nil {
+		return err
+	}
+	if ok {
+		filter, err := feature.ParseCommandFilterRules(filterRules)
+		if err != nil {
+			return err
+		}
+		store.GetGlobalStore().Set(feature.CommandFilterKey, filter)
+	}
+
+	// 按内容识别敏感数据，弥补按列名匹配的规则遗漏的列
+	if args.DLPScan || len(args.DLPPatterns) != 0 {
+		detector, err := feature.NewDetector(args.DLPSampleRate, args.DLPPatterns)
+		if err != nil {
 			return err
 		}
-		store.GetGlobalStore().Set(feature.DataMaskingKey, rules)
-		// 删除某个参数
-		values.Del(feature.DataMaskingKey)
-		// 如果还剩参数就重新拼回 DSN
-		newDSN := base
+		store.GetGlobalStore().Set(feature.DataDetectorKey, detector)
+	}
+
+	// 查询结果的读取限制，命名连接中配置的限制与命令行参数取更严格的一个
+	// 连接时按连接名查找，\c 切换到命名连接时同样生效
+	limits := &feature.ResultLimits{
+		Default: feature.ResultLimit{MaxRows: args.MaxRows, MaxBytes: args.MaxResultBytes},
+		Conns:   make(map[string]feature.ResultLimit),
+	}
+	for name, v := range connections {
+		limit, err := connLimit(v)
+		if err != nil {
+			return fmt.Errorf("named connection %q: %w", name, err)
+		}
+		if !limit.Empty() {
+			limits.Conns[name] = limit
+		}
+	}
+	if !limits.Default.Empty() || len(limits.Conns) != 0 {
+		store.GetGlobalStore().Set(feature.ResultLimitKey, limits)
+	}
+
+	// 审计日志记录每一条执行的语句
+	if args.AuditLog != "" || args.AuditLogFD >= 0 {
+		sink, err := openAuditSink(args.AuditLog, args.AuditLogFD)
+		if err != nil {
+			return err
+		}
+		defer sink.Close()
+		store.GetGlobalStore().Set(feature.AuditLogKey, feature.NewAuditLog(sink, args.SessionID, u.Username))
+	}
+
+	// 令牌化密钥由启动方通过 DSN 或环境变量传入，读取后立即清除，
+	// 避免会话中通过 \getenv 等方式看到；未传入时使用随机的会话密钥
+	tokenKeyEnv := text.CommandUpper() + "_DATA_MASKING_TOKEN_KEY"
+	tokenKey := []byte(os.Getenv(tokenKeyEnv))
+	_ = os.Unsetenv(tokenKeyEnv)
+	if values.Has(feature.DataMaskingTokenKey) {
+		tokenKey = []byte(values.Get(feature.DataMaskingTokenKey))
+		values.Del(feature.DataMaskingTokenKey)
+		stripped = true
+	}
+	if len(tokenKey) == 0 {
+		if tokenKey, err = feature.NewTokenKey(); err != nil {
+			return err
+		}
+	}
+	store.GetGlobalStore().Set(feature.DataMaskingTokenKey, tokenKey)
+
+	// 只读模式需要在打开连接前设置，连接参数和驱动都会读取
+	if args.ReadOnly {
+		store.GetGlobalStore().Set(feature.ReadOnlyKey, true)
+	}
+
+	// 如果还剩参数就重新拼回 DSN
+	if stripped {
+		dsn = base
 		if len(values.Encode()) > 0 {
-			newDSN = fmt.Sprintf("%s?%s", base, values.Encode())
+			dsn = fmt.Sprintf("%s?%s", base, values.Encode())
 		}
-		dsn = newDSN
 	}
 
 	// open dsn
@@ -400,16 +551,113 @@ func Run(ctx context.Context, args *Args, connections map[string]interface{}, in
 
 // Args are the command line arguments.
 type Args struct {
-	DSN               string
-	CommandOrFiles    []CommandOrFile
-	Out               string
-	ForcePassword     bool
-	NoPassword        bool
-	NoInit            bool
-	SingleTransaction bool
-	Vars              []string
-	Cvars             []string
-	Pvars             []string
+	DSN                  string
+	CommandOrFiles       []CommandOrFile
+	Out                  string
+	ForcePassword        bool
+	NoPassword           bool
+	NoInit               bool
+	SingleTransaction    bool
+	ReadOnly             bool
+	Record               string
+	MaxRows              int64
+	MaxResultBytes       int64
+	StatementTimeout     time.Duration
+	Vars                 []string
+	Cvars                []string
+	Pvars                []string
+	MaskingRulesFile     string
+	MaskingRulesFD       int
+	RequireSignedMasking bool
+	LenientMasking       bool
+	DLPScan              bool
+	DLPSampleRate        float64
+	DLPPatterns          []string
+	CommandFilterFile    string
+	CommandFilterFD      int
+	MaskingPublicKey     string
+	SessionID            string
+	AuditLog             string
+	AuditLogFD           int
+}
+
+// ruleSource 规则的来源：文件、继承的文件描述符、环境变量或 DSN 参数，最多只能指定一个
+type ruleSource struct {
+	// name 规则的名称，用于错误信息
+	name string
+	file string
+	// fd 小于 0 时不从文件描述符读取
+	fd  int
+	env string
+}
+
+// read 读取规则内容并从 values 中删除 DSN 参数 key，环境变量读取后立即清除，
+// 避免会话中通过 \getenv 等方式看到。未指定任何来源时返回 false
+func (s ruleSource) read(values url.Values, key string) (string, bool, error) {
+	var sources []string
+	envValue, envSet := os.LookupEnv(s.env)
+	_ = os.Unsetenv(s.env)
+	if s.file != "" {
+		sources = append(sources, "file")
+	}
+	if s.fd >= 0 {
+		sources = append(sources, "file descriptor")
+	}
+	if envSet {
+		sources = append(sources, "environment variable "+s.env)
+	}
+	if values.Has(key) {
+		sources = append(sources, "DSN parameter "+key)
+	}
+	switch {
+	case len(sources) == 0:
+		return "", false, nil
+	case len(sources) > 1:
+		return "", false, fmt.Errorf("%s given by more than one source: %s", s.name, strings.Join(sources, ", "))
+	}
+	switch {
+	case s.file != "":
+		buf, err := os.ReadFile(s.file)
+		if err != nil {
+			return "", false, fmt.Errorf("unable to read %s: %w", s.name, err)
+		}
+		return string(buf), true, nil
+	case s.fd >= 0:
+		f := os.NewFile(uintptr(s.fd), s.name)
+		if f == nil {
+			return "", false, fmt.Errorf("unable to read %s: invalid file descriptor %d", s.name, s.fd)
+		}
+		defer f.Close()
+		buf, err := io.ReadAll(f)
+		if err != nil {
+			return "", false, fmt.Errorf("unable to read %s from file descriptor %d: %w", s.name, s.fd, err)
+		}
+		return string(buf), true, nil
+	case envSet:
+		return envValue, true, nil
+	}
+	v := values.Get(key)
+	values.Del(key)
+	return v, true, nil
+}
+
+// openAuditSink 打开审计日志的输出，文件（或 unix socket）和文件描述符只能指定一个
+func openAuditSink(target string, fd int) (io.WriteCloser, error) {
+	switch {
+	case target != "" && fd >= 0:
+		return nil, fmt.Errorf("audit log given by more than one source: file, file descriptor")
+	case fd >= 0:
+		f := os.NewFile(uintptr(fd), "audit log")
+		if f == nil {
+			return nil, fmt.Errorf("unable to open audit log: invalid file descriptor %d", fd)
+		}
+		return f, nil
+	}
+	w, err := feature.OpenAuditSink(target)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open audit log: %w", err)
+	}
+	return w, nil
 }
 
 // CommandOrFile is a special type to deal with interspersed -c, -f,
@@ -522,6 +770,30 @@ func setConn(name string, v interface{}) error {
 	return text.ErrInvalidConfig
 }
 
+// connLimit 读取命名连接中配置的 max-rows 和 max-result-bytes
+func connLimit(v interface{}) (feature.ResultLimit, error) {
+	var limit feature.ResultLimit
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return limit, nil
+	}
+	for key, dst := range map[string]*int64{
+		"max-rows":         &limit.MaxRows,
+		"max-result-bytes": &limit.MaxBytes,
+	} {
+		val, ok := m[key]
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(fmt.Sprint(val), 10, 64)
+		if err != nil {
+			return limit, fmt.Errorf("invalid %s value %q: %w", key, fmt.Sprint(val), err)
+		}
+		*dst = n
+	}
+	return limit, nil
+}
+
 // runCommandOrFiles processes all the supplied commands or files.
 func runCommandOrFiles(h *handler.Handler, commandsOrFiles []CommandOrFile) func() error {
 	return func() error {
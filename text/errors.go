@@ -77,4 +77,32 @@ var (
 	ErrNamedConnectionIsNotAURL = errors.New("named connection is not a url")
 	// ErrInvalidConfig is the invalid config error.
 	ErrInvalidConfig = errors.New("invalid config")
+	// ErrUnknownMaskingMethod is the unknown masking method error.
+	ErrUnknownMaskingMethod = errors.New("unknown masking method")
+	// ErrInvalidMaskingParam is the invalid masking parameter error.
+	ErrInvalidMaskingParam = errors.New("invalid masking parameter")
+	// ErrEmptyMaskingPattern is the empty masking pattern error.
+	ErrEmptyMaskingPattern = errors.New("empty pattern")
+	// ErrInvalidMaskingPattern is the invalid masking pattern error.
+	ErrInvalidMaskingPattern = errors.New("invalid pattern")
+	// ErrSignedMaskingRequired is the signed masking rules required error.
+	ErrSignedMaskingRequired = errors.New("signed data masking rule bundle required")
+	// ErrInvalidMaskingBundle is the invalid masking rule bundle error.
+	ErrInvalidMaskingBundle = errors.New("invalid data masking rule bundle")
+	// ErrMaskingBundleSignature is the masking rule bundle signature verification failed error.
+	ErrMaskingBundleSignature = errors.New("data masking rule bundle signature verification failed")
+	// ErrMaskingBundleExpired is the masking rule bundle expired error.
+	ErrMaskingBundleExpired = errors.New("data masking rule bundle expired")
+	// ErrMaskingBundleSession is the masking rule bundle session mismatch error.
+	ErrMaskingBundleSession = errors.New("data masking rule bundle is bound to another session")
+	// ErrMaskingPublicKeyMissing is the missing masking public key error.
+	ErrMaskingPublicKeyMissing = errors.New("no public key to verify data masking rule bundle")
+	// ErrMaskingPublicKeyEmbedded is the masking public key cannot be overridden error.
+	ErrMaskingPublicKeyEmbedded = errors.New("data masking public key is embedded at build time and cannot be overridden")
+	// ErrInvalidMaskingPublicKey is the invalid masking public key error.
+	ErrInvalidMaskingPublicKey = errors.New("invalid data masking public key")
+	// ErrStatementTimeout is the statement canceled due to statement timeout error.
+	ErrStatementTimeout = errors.New("canceling statement due to statement timeout")
+	// ErrStatementCanceled is the statement canceled due to user request error.
+	ErrStatementCanceled = errors.New("canceling statement due to user request")
 )
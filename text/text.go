@@ -95,6 +95,14 @@ var (
 	NotificationPayload    = `with payload %q `
 	UnknownShortAlias      = `(unk)`
 	InvalidNamedConnection = `warning: named connection %q was not defined: %v`
+	MaskingColumnBlocked   = `column %q is derived from masked column %q and is blocked by masking rule %q`
+	MaskingSourceUnknown   = `cannot determine the source of column %q, blocked by masking rule %q`
+	CommandDenied          = `statement denied by command filter rule %q`
+	CommandNotConfirmed    = `statement not confirmed (command filter rule %q requires confirmation)`
+	CommandConfirmPrompt   = `Command filter rule %q requires confirmation. Execute? [y/N] `
+	ReadOnlyDenied         = `%s statement not allowed in read-only mode`
+	ResultTruncated        = `result truncated at %d rows by policy`
+	InvalidTimeout         = `invalid STATEMENT_TIMEOUT value %q: a duration such as 30s is expected`
 	UsageTemplate          = `Usage:
   {{.UseLine}}
 